@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/xor-gate/ar"
+	"github.com/xor-gate/debpkg/internal/targzip"
 )
 
 func addArFileFromBuffer(now time.Time, w *ar.Writer, name string, body []byte) error {
@@ -22,7 +23,7 @@ func addArFileFromBuffer(now time.Time, w *ar.Writer, name string, body []byte)
 	}
 
 	if err := w.WriteHeader(&hdr); err != nil {
-		return fmt.Errorf("cannot write file header: %v", err)
+		return fmt.Errorf("cannot write file header: %w", err)
 	}
 
 	_, err := w.Write(body)
@@ -30,41 +31,53 @@ func addArFileFromBuffer(now time.Time, w *ar.Writer, name string, body []byte)
 	return err
 }
 
-func addArFile(now time.Time, w *ar.Writer, dstname, filename string) error {
-	f, err := os.Open(filename)
+func addArFile(now time.Time, w *ar.Writer, dstname string, tgz *targzip.TarGzip) error {
+	f, err := tgz.Open()
 	if err != nil {
 		return err
 	}
-
-	stat, err := f.Stat()
-	if err != nil {
-		f.Close()
-		return err
-	}
+	defer f.Close()
 
 	hdr := ar.Header{
 		Name:    dstname,
-		Size:    stat.Size(),
+		Size:    tgz.Size(),
 		Mode:    0644,
 		ModTime: now,
 	}
 
 	if err := w.WriteHeader(&hdr); err != nil {
-		f.Close()
-		return fmt.Errorf("cannot write file header: %v", err)
+		return fmt.Errorf("cannot write file header: %w", err)
 	}
 
 	_, err = io.Copy(w, f)
-	f.Close()
 
 	return err
 }
 
-func (deb *DebPkg) createDebAr(filename string) error {
+// countWriter counts the bytes written to w, a write is refused when cancel returns an error
+type countWriter struct {
+	w      io.Writer
+	n      int64
+	cancel func() error
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.cancel != nil {
+		if err := cw.cancel(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// createDebAr writes the package to filename, the file is removed when an error occurs
+func (deb *DebPkg) createDebAr(filename, signature string) error {
 	removeDeb := true
 	fd, err := os.Create(filename)
 	if err != nil {
-		return fmt.Errorf("unable to create: %s", filename)
+		return &FileError{Op: "create", Dest: filename, Err: err}
 	}
 
 	defer func() {
@@ -74,28 +87,56 @@ func (deb *DebPkg) createDebAr(filename string) error {
 		}
 	}()
 
-	now := time.Now()
-	w := ar.NewWriter(fd)
+	if err := deb.writeDebAr(&countWriter{w: fd}, signature); err != nil {
+		return err
+	}
+
+	removeDeb = false
+
+	return nil
+}
+
+// writeDebAr writes the ar archive with the debian-binary, control, data and the clearsigned digest
+// signature (unsigned when empty)
+func (deb *DebPkg) writeDebAr(out *countWriter, signature string) error {
+	now := deb.now()
+	w := ar.NewWriter(out)
+	out.cancel = deb.ctxErr
+	notify := func(name string) error {
+		return deb.notify(Event{Stage: StageAr, Name: name, Written: uint64(out.n)})
+	}
 
 	if err := w.WriteGlobalHeader(); err != nil {
-		return fmt.Errorf("cannot write ar header to deb file: %v", err)
+		return fmt.Errorf("cannot write ar header to deb file: %w", err)
 	}
 	if err := addArFileFromBuffer(now, w, "debian-binary", []byte(deb.debianBinary)); err != nil {
-		return fmt.Errorf("cannot pack debian-binary: %v", err)
+		return fmt.Errorf("cannot pack debian-binary: %w", err)
+	}
+	if err := notify("debian-binary"); err != nil {
+		return err
 	}
-	if err := addArFile(now, w, "control.tar.gz", deb.control.tgz.Name()); err != nil {
-		return fmt.Errorf("cannot add control.tar.gz to deb: %v", err)
+	controlName := "control" + deb.control.tgz.Extension()
+	if err := addArFile(now, w, controlName, deb.control.tgz); err != nil {
+		return fmt.Errorf("cannot add %s to deb: %w", controlName, err)
 	}
-	if err := addArFile(now, w, "data.tar.gz", deb.data.tgz.Name()); err != nil {
-		return fmt.Errorf("cannot add data.tar.gz to deb: %v", err)
+	if err := notify(controlName); err != nil {
+		return err
+	}
+	dataName := "data" + deb.data.tgz.Extension()
+	if err := addArFile(now, w, dataName, deb.data.tgz); err != nil {
+		return fmt.Errorf("cannot add %s to deb: %w", dataName, err)
+	}
+	if err := notify(dataName); err != nil {
+		return err
 	}
-	if deb.digest.clearsign != "" {
-		if err := addArFileFromBuffer(now, w, "digests.asc", []byte(deb.digest.clearsign)); err != nil {
-			return fmt.Errorf("cannot add digests.asc to deb: %v", err)
+	if signature != "" {
+		if err := addArFileFromBuffer(now, w, "digests.asc", []byte(signature)); err != nil {
+			return fmt.Errorf("cannot add digests.asc to deb: %w", err)
+		}
+		if err := notify("digests.asc"); err != nil {
+			return err
 		}
 	}
 
-	removeDeb = false
-
 	return nil
 }
@@ -0,0 +1,271 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// changelogDateLayout is the RFC 2822 date of the changelog trailer, the day may be a single digit when parsing
+const changelogDateLayout = "Mon, 2 Jan 2006 15:04:05 -0700"
+
+var (
+	// changelogHeader matches the first line of an entry. E.g: "foo (1.0-1) unstable; urgency=medium"
+	changelogHeader = regexp.MustCompile(`^(\S+) \(([^()\s]+)\) ([^;]+);\s*(.*)$`)
+	// changelogTrailer matches the last line of an entry. E.g: " -- Foo Bar <foo@bar.com>  Mon, 02 Jan 2006 15:04:05 +0000"
+	changelogTrailer = regexp.MustCompile(`^ -- (.+?)  (\S.*)$`)
+)
+
+// ChangelogEntry is a single release in the changelog
+type ChangelogEntry struct {
+	Package      string    // Source package name. E.g: "foo"
+	Version      string    // E.g: "1:1.2.3-1"
+	Distribution string    // E.g: "unstable"
+	Urgency      string    // "low", "medium", "high", "emergency" or "critical"
+	Changes      []string  // Bullets, lines after the first are continuation lines. E.g: "Fix crash on startup."
+	Author       string    // RFC822 address. E.g: "Foo Bar <foo@bar.com>"
+	Date         time.Time // Release date
+}
+
+// Changelog is a debian/changelog with the newest entry first. It is installed as
+// /usr/share/doc/<name>/changelog.Debian.gz with SetChangelog.
+// See: https://www.debian.org/doc/debian-policy/ch-source.html#debian-changelog-debian-changelog
+type Changelog struct {
+	Entries []ChangelogEntry
+}
+
+// ReadChangelog parses the debian/changelog file, problems are returned as *SpecError pointing to the line
+func ReadChangelog(filename string) (*Changelog, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, &FileError{Op: "read changelog", Src: filename, Err: err}
+	}
+	defer f.Close()
+
+	c, err := ParseChangelog(f)
+	if serr, ok := err.(*SpecError); ok {
+		serr.File = filename
+	}
+	return c, err
+}
+
+// ParseChangelog parses a changelog in the debian/changelog format, problems are returned as *SpecError
+// pointing to the line. Blank lines and group headers like "[ Foo Bar ]" between the bullets are kept as
+// changes, other body lines are continuation lines of the previous bullet.
+func ParseChangelog(r io.Reader) (*Changelog, error) {
+	c := &Changelog{}
+	var entry *ChangelogEntry
+	lineError := func(n int, format string, a ...interface{}) error {
+		return &SpecError{Line: n, Err: fmt.Errorf(format, a...)}
+	}
+
+	n := 0
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		n++
+		line := strings.TrimRight(s.Text(), " \t")
+		switch {
+		case entry == nil && line == "":
+		case entry == nil:
+			m := changelogHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, lineError(n, "malformed entry header %q", line)
+			}
+			entry = &ChangelogEntry{Package: m[1], Version: m[2], Distribution: strings.TrimSpace(m[3])}
+			for _, option := range strings.Split(m[4], ",") {
+				kv := strings.SplitN(strings.TrimSpace(option), "=", 2)
+				if len(kv) == 2 && strings.ToLower(kv[0]) == "urgency" {
+					entry.Urgency = strings.ToLower(kv[1])
+				}
+			}
+		case strings.HasPrefix(line, " -- "):
+			m := changelogTrailer.FindStringSubmatch(line)
+			if m == nil {
+				return nil, lineError(n, "malformed entry trailer %q", line)
+			}
+			date, err := time.Parse(changelogDateLayout, m[2])
+			if err != nil {
+				return nil, lineError(n, "invalid date %q: %v", m[2], err)
+			}
+			entry.Author, entry.Date = m[1], date
+			c.Entries = append(c.Entries, *entry)
+			entry = nil
+		case strings.HasPrefix(line, "  * "):
+			entry.Changes = append(entry.Changes, line[4:])
+		case strings.HasPrefix(line, "  [ ") || (line == "" && len(entry.Changes) > 0):
+			entry.Changes = append(entry.Changes, strings.TrimSpace(line))
+		case line == "":
+		case strings.HasPrefix(line, "  ") && len(entry.Changes) > 0:
+			entry.Changes[len(entry.Changes)-1] += "\n" + strings.TrimSpace(line)
+		default:
+			return nil, lineError(n, "malformed change %q", line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return nil, lineError(n, "missing trailer of entry %s (%s)", entry.Package, entry.Version)
+	}
+	for i := range c.Entries {
+		// Drop the blank line before the trailer
+		changes := c.Entries[i].Changes
+		for len(changes) > 0 && changes[len(changes)-1] == "" {
+			changes = changes[:len(changes)-1]
+		}
+		c.Entries[i].Changes = changes
+	}
+	return c, nil
+}
+
+// AddEntry adds the entry as newest release on top of the changelog
+func (c *Changelog) AddEntry(entry ChangelogEntry) {
+	c.Entries = append([]ChangelogEntry{entry}, c.Entries...)
+}
+
+// Validate checks the changelog has entries with a package name, version, distribution, urgency,
+// author and date
+func (c *Changelog) Validate() error {
+	if len(c.Entries) == 0 {
+		return &ValidationError{Field: "Changelog", Err: fmt.Errorf("no entries")}
+	}
+	for _, e := range c.Entries {
+		if !validPackageName.MatchString(e.Package) {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("invalid package name %q", e.Package)}
+		}
+		if _, err := ParseVersion(e.Version); err != nil {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("invalid version of %s: %w", e.Package, err)}
+		}
+		if strings.TrimSpace(e.Distribution) == "" {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("empty distribution of %s (%s)", e.Package, e.Version)}
+		}
+		if !validUrgency(e.Urgency) {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("invalid urgency %q of %s (%s)",
+				e.Urgency, e.Package, e.Version)}
+		}
+		if addr, err := mail.ParseAddress(e.Author); err != nil || addr.Name == "" {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("invalid author %q of %s (%s): not a RFC822 address",
+				e.Author, e.Package, e.Version)}
+		}
+		if e.Date.IsZero() {
+			return &ValidationError{Field: "Changelog", Err: fmt.Errorf("missing date of %s (%s)", e.Package, e.Version)}
+		}
+	}
+	return nil
+}
+
+// String returns the changelog in the canonical debian/changelog format as written by dch
+func (c *Changelog) String() string {
+	var b bytes.Buffer
+	for i, e := range c.Entries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s (%s) %s; urgency=%s\n\n", e.Package, e.Version, e.Distribution, e.Urgency)
+		for _, change := range e.Changes {
+			lines := strings.Split(change, "\n")
+			switch {
+			case change == "":
+				b.WriteString("\n")
+				continue
+			case strings.HasPrefix(change, "[ "):
+				fmt.Fprintf(&b, "  %s\n", lines[0])
+			default:
+				fmt.Fprintf(&b, "  * %s\n", lines[0])
+			}
+			for _, line := range lines[1:] {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		fmt.Fprintf(&b, "\n -- %s  %s\n", e.Author, e.Date.Format(time.RFC1123Z))
+	}
+	return b.String()
+}
+
+// gzip returns the changelog compressed without name and timestamp as installed in the package
+func (c *Changelog) gzip() ([]byte, error) {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, c.String()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// maintainer returns the name and email of the author of the newest entry
+func (c *Changelog) maintainer() (name, email string, err error) {
+	addr, err := mail.ParseAddress(c.Entries[0].Author)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid author %q: %w", c.Entries[0].Author, err)
+	}
+	return addr.Name, addr.Address, nil
+}
+
+// validUrgency reports whether the urgency is one of changesUrgencies
+func validUrgency(urgency string) bool {
+	for _, u := range changesUrgencies {
+		if urgency == u {
+			return true
+		}
+	}
+	return false
+}
+
+// SetChangelog sets the changelog which is installed as /usr/share/doc/<name>/changelog.Debian.gz on write.
+// The version and maintainer default to the newest entry when not set.
+func (deb *DebPkg) SetChangelog(c *Changelog) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	if deb.control.info.version == (controlInfoVersion{}) {
+		version := c.Entries[0].Version
+		if _, err := ParseVersion(version); err != nil {
+			return &ValidationError{Field: "Version", Err: err}
+		}
+		deb.SetVersion(version)
+	}
+	if deb.control.info.maintainer == "" && deb.control.info.maintainerEmail == "" {
+		name, email, err := c.maintainer()
+		if err != nil {
+			return &ValidationError{Field: "Maintainer", Err: err}
+		}
+		deb.SetMaintainer(name)
+		deb.SetMaintainerEmail(email)
+	}
+	deb.changelog = c
+	return nil
+}
+
+// addChangelog adds the gzipped changelog to the data archive
+func (deb *DebPkg) addChangelog() error {
+	if deb.changelog == nil {
+		return nil
+	}
+	b, err := deb.changelog.gzip()
+	if err != nil {
+		return err
+	}
+	dest := "/usr/share/doc/" + deb.control.info.name + "/changelog.Debian.gz"
+	return fileError("add file", "", dest, deb.data.addFileString(string(b), dest))
+}
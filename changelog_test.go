@@ -0,0 +1,173 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+const testChangelog = `foo (1.1.0-1) bookworm; urgency=high
+
+  [ Foo Bar ]
+  * Fix crash on startup.
+  * Document the new option in the manpage, which
+    is wrapped.
+
+  [ Bar Baz ]
+  * Add foo-data package.
+
+ -- Foo Bar <foo@bar.com>  Tue, 01 Aug 2017 12:00:00 +0200
+
+foo (1.0.0-1) unstable; urgency=medium
+
+  * Initial release.
+
+ -- Foo Bar <foo@bar.com>  Mon, 31 Jul 2017 09:30:00 +0000
+`
+
+func TestParseChangelog(t *testing.T) {
+	c, err := ParseChangelog(strings.NewReader(testChangelog))
+	require.Nil(t, err)
+	require.Len(t, c.Entries, 2)
+
+	e := c.Entries[0]
+	assert.Equal(t, "foo", e.Package)
+	assert.Equal(t, "1.1.0-1", e.Version)
+	assert.Equal(t, "bookworm", e.Distribution)
+	assert.Equal(t, "high", e.Urgency)
+	assert.Equal(t, []string{"[ Foo Bar ]", "Fix crash on startup.",
+		"Document the new option in the manpage, which\nis wrapped.", "", "[ Bar Baz ]", "Add foo-data package."}, e.Changes)
+	assert.Equal(t, "Foo Bar <foo@bar.com>", e.Author)
+	assert.True(t, e.Date.Equal(time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)))
+	assert.Equal(t, []string{"Initial release."}, c.Entries[1].Changes)
+
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, testChangelog, c.String())
+}
+
+func TestParseChangelogError(t *testing.T) {
+	for _, tc := range []struct {
+		changelog string
+		line      int
+	}{
+		{"foo 1.0 unstable; urgency=low\n", 1},
+		{"foo (1.0) unstable; urgency=low\n\nInitial release.\n", 3},
+		{"foo (1.0) unstable; urgency=low\n\n  * Initial release.\n\n -- Foo Bar <foo@bar.com> 2017-08-01\n", 5},
+		{"foo (1.0) unstable; urgency=low\n\n  * Initial release.\n\n -- Foo Bar <foo@bar.com>  2017-08-01\n", 5},
+		{"foo (1.0) unstable; urgency=low\n\n  * Initial release.\n", 3},
+	} {
+		_, err := ParseChangelog(strings.NewReader(tc.changelog))
+		var serr *SpecError
+		if assert.True(t, errors.As(err, &serr), tc.changelog) {
+			assert.Equal(t, tc.line, serr.Line, tc.changelog)
+		}
+	}
+
+	_, err := ReadChangelog("/non/existent/changelog")
+	var ferr *FileError
+	assert.True(t, errors.As(err, &ferr))
+}
+
+func TestChangelogValidate(t *testing.T) {
+	c := &Changelog{}
+	var verr *ValidationError
+	assert.True(t, errors.As(c.Validate(), &verr))
+
+	entry := ChangelogEntry{
+		Package:      "foo",
+		Version:      "1.0",
+		Distribution: "unstable",
+		Urgency:      "medium",
+		Author:       "Foo Bar <foo@bar.com>",
+		Date:         time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC),
+	}
+	c.AddEntry(entry)
+	assert.Nil(t, c.Validate())
+
+	for _, modify := range []func(e *ChangelogEntry){
+		func(e *ChangelogEntry) { e.Package = "Foo" },
+		func(e *ChangelogEntry) { e.Version = "" },
+		func(e *ChangelogEntry) { e.Distribution = "" },
+		func(e *ChangelogEntry) { e.Urgency = "urgent" },
+		func(e *ChangelogEntry) { e.Author = "foo@bar.com" },
+		func(e *ChangelogEntry) { e.Date = time.Time{} },
+	} {
+		e := entry
+		modify(&e)
+		c := &Changelog{Entries: []ChangelogEntry{e}}
+		assert.True(t, errors.As(c.Validate(), &verr))
+		assert.Equal(t, "Changelog", verr.Field)
+	}
+}
+
+func TestSetChangelog(t *testing.T) {
+	c := &Changelog{}
+	c.AddEntry(ChangelogEntry{
+		Package:      "foo",
+		Version:      "1.0.0-1",
+		Distribution: "unstable",
+		Urgency:      "medium",
+		Changes:      []string{"Initial release."},
+		Author:       "Foo Bar <foo@bar.com>",
+		Date:         time.Date(2017, 7, 31, 12, 0, 0, 0, time.UTC),
+	})
+	c.AddEntry(ChangelogEntry{
+		Package:      "foo",
+		Version:      "1.1.0-1",
+		Distribution: "unstable",
+		Urgency:      "low",
+		Changes:      []string{"Fix crash on startup."},
+		Author:       "Bar Baz <bar@baz.com>",
+		Date:         time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	deb := New()
+	defer deb.Close()
+	deb.SetName("foo")
+	deb.SetArchitecture("all")
+	deb.SetShortDescription("foo package")
+	assert.NotNil(t, deb.SetChangelog(&Changelog{}))
+	require.Nil(t, deb.SetChangelog(c))
+	assert.Equal(t, "foo-1.1.0-1_all.deb", deb.GetFilename())
+
+	filename := filepath.Join(test.TempDir(), "changelog-"+deb.GetFilename())
+	require.Nil(t, deb.Write(filename))
+	assert.Equal(t, ErrWritten, deb.SetChangelog(c))
+
+	r, err := Open(filename)
+	require.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, "1.1.0-1", r.ControlField("Version"))
+	assert.Equal(t, "Bar Baz <bar@baz.com>", r.ControlField("Maintainer"))
+	assert.Contains(t, r.MD5Sums(), "usr/share/doc/foo/changelog.Debian.gz")
+
+	it, err := r.Data()
+	require.Nil(t, err)
+	defer it.Close()
+	for {
+		hdr, err := it.Next()
+		require.Nil(t, err)
+		if strings.HasSuffix(hdr.Name, "changelog.Debian.gz") {
+			break
+		}
+	}
+	gz, err := gzip.NewReader(it)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(gz)
+	require.Nil(t, err)
+	assert.Equal(t, c.String(), string(b))
+	assert.True(t, strings.HasPrefix(string(b), "foo (1.1.0-1) unstable; urgency=low\n\n  * Fix crash on startup.\n\n"+
+		" -- Bar Baz <bar@baz.com>  Tue, 01 Aug 2017 12:00:00 +0000\n\nfoo (1.0.0-1)"))
+}
@@ -0,0 +1,324 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const changesFormat = "1.8"
+
+// changesUrgencies are the valid values of the Urgency field
+var changesUrgencies = []string{"low", "medium", "high", "emergency", "critical"}
+
+// Changes builds the .changes file describing an upload of one or more built packages as accepted by
+// dput, dupload and reprepro. The source, version and maintainer are taken from the first package.
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#debian-changes-files-changes
+type Changes struct {
+	files        []changesFile
+	distribution string
+	urgency      string
+	changedBy    string
+	date         time.Time
+	changes      []string
+}
+
+// changesFile is a single package of the upload
+type changesFile struct {
+	name         string // Base filename. E.g: "foo_1.0_amd64.deb"
+	pkg          string // Package name
+	version      string
+	architecture string
+	source       string // Source package name, the package name when absent
+	sourceVer    string // Source version, the package version when absent
+	maintainer   string
+	description  string // Short description
+	section      string
+	priority     string
+	size         int64
+	md5sum       string
+	sha1sum      string
+	sha256sum    string
+}
+
+// NewChanges creates an empty .changes file for distribution "unstable" with urgency "medium"
+func NewChanges() *Changes {
+	return &Changes{
+		distribution: "unstable",
+		urgency:      "medium",
+	}
+}
+
+// AddPackage adds the built package filename to the upload, the package is read for the control fields
+// and checksums. The file is expected next to the .changes file when uploading.
+func (c *Changes) AddPackage(filename string) error {
+	r, err := Open(filename)
+	if err != nil {
+		return fileError("add package", filename, "", err)
+	}
+	defer r.Close()
+
+	f := changesFile{
+		name:         filepath.Base(filename),
+		pkg:          r.ControlField("Package"),
+		version:      r.ControlField("Version"),
+		architecture: r.ControlField("Architecture"),
+		maintainer:   r.ControlField("Maintainer"),
+		description:  strings.SplitN(r.ControlField("Description"), "\n", 2)[0],
+		section:      r.ControlField("Section"),
+		priority:     r.ControlField("Priority"),
+	}
+	f.source, f.sourceVer = f.pkg, f.version
+	if source := strings.Fields(r.ControlField("Source")); len(source) > 0 {
+		f.source = source[0]
+		if len(source) > 1 {
+			f.sourceVer = strings.Trim(source[1], "()")
+		}
+	}
+	if f.section == "" {
+		f.section = "misc"
+	}
+	if f.priority == "" {
+		f.priority = string(PriorityOptional)
+	}
+
+	fd, err := os.Open(filename)
+	if err != nil {
+		return fileError("add package", filename, "", err)
+	}
+	defer fd.Close()
+	md5sum, sha1sum, sha256sum := md5.New(), sha1.New(), sha256.New()
+	if f.size, err = io.Copy(io.MultiWriter(md5sum, sha1sum, sha256sum), fd); err != nil {
+		return fileError("add package", filename, "", err)
+	}
+	f.md5sum = fmt.Sprintf("%x", md5sum.Sum(nil))
+	f.sha1sum = fmt.Sprintf("%x", sha1sum.Sum(nil))
+	f.sha256sum = fmt.Sprintf("%x", sha256sum.Sum(nil))
+
+	c.files = append(c.files, f)
+	return nil
+}
+
+// SetDistribution sets the target distribution (default "unstable"). E.g: "bookworm-backports"
+func (c *Changes) SetDistribution(distribution string) {
+	c.distribution = distribution
+}
+
+// SetUrgency sets the urgency of the upload: "low", "medium" (default), "high", "emergency" or "critical"
+func (c *Changes) SetUrgency(urgency string) {
+	c.urgency = urgency
+}
+
+// SetChangedBy sets the author of the changes, defaults to the maintainer. E.g: "Foo Bar <foo@bar.com>"
+func (c *Changes) SetChangedBy(changedBy string) {
+	c.changedBy = changedBy
+}
+
+// SetDate sets the date of the upload, defaults to the current time
+func (c *Changes) SetDate(t time.Time) {
+	c.date = t
+}
+
+// SetChanges sets the changes of the upload, each change is a bullet of the changelog entry and may
+// span several lines
+func (c *Changes) SetChanges(changes ...string) {
+	c.changes = changes
+}
+
+// Validate checks the upload has packages of a single source and a valid distribution and urgency
+func (c *Changes) Validate() error {
+	if len(c.files) == 0 {
+		return fmt.Errorf("no packages in the upload")
+	}
+	for _, f := range c.files[1:] {
+		if f.source != c.files[0].source {
+			return &ValidationError{Field: "Source", Err: fmt.Errorf("packages of multiple sources %s and %s",
+				c.files[0].source, f.source)}
+		}
+	}
+	if c.distribution == "" || strings.ContainsAny(c.distribution, " \t\n") {
+		return &ValidationError{Field: "Distribution", Err: fmt.Errorf("invalid distribution %q", c.distribution)}
+	}
+	if validUrgency(c.urgency) {
+		return nil
+	}
+	return &ValidationError{Field: "Urgency", Err: fmt.Errorf("invalid urgency %q", c.urgency)}
+}
+
+// GetFilename returns the canonical .changes filename "source_version_arch.changes", the epoch is omitted
+// and the architecture is "multi" for packages of multiple architectures
+func (c *Changes) GetFilename() string {
+	if len(c.files) == 0 {
+		return ".changes"
+	}
+	archs := c.architectures()
+	arch := archs[0]
+	if len(archs) > 1 {
+		arch = "multi"
+	}
+	version := c.files[0].sourceVer
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	return fmt.Sprintf("%s_%s_%s.changes", c.files[0].source, version, arch)
+}
+
+// String returns the unsigned .changes file
+func (c *Changes) String() string {
+	if len(c.files) == 0 {
+		return ""
+	}
+	first := c.files[0]
+	date := c.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	changedBy := c.changedBy
+	if changedBy == "" {
+		changedBy = first.maintainer
+	}
+
+	var binaries []string
+	seen := make(map[string]bool)
+	for _, f := range c.files {
+		if !seen[f.pkg] {
+			seen[f.pkg] = true
+			binaries = append(binaries, f.pkg)
+		}
+	}
+	sort.Strings(binaries)
+
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	field("Format", changesFormat)
+	field("Date", date.Format(time.RFC1123Z))
+	field("Source", first.source)
+	field("Binary", strings.Join(binaries, " "))
+	field("Architecture", strings.Join(c.architectures(), " "))
+	field("Version", first.sourceVer)
+	field("Distribution", c.distribution)
+	field("Urgency", c.urgency)
+	field("Maintainer", first.maintainer)
+	field("Changed-By", changedBy)
+
+	b.WriteString("Description:\n")
+	described := make(map[string]bool)
+	for _, f := range c.files {
+		if !described[f.pkg] {
+			described[f.pkg] = true
+			fmt.Fprintf(&b, " %s - %s\n", f.pkg, f.description)
+		}
+	}
+
+	fmt.Fprintf(&b, "Changes:\n %s (%s) %s; urgency=%s\n .\n", first.source, first.sourceVer, c.distribution, c.urgency)
+	changes := c.changes
+	if len(changes) == 0 {
+		changes = []string{"Upload of " + first.source + " " + first.sourceVer + "."}
+	}
+	for _, change := range changes {
+		// Continuation lines are indented below the bullet and blank lines are a " ." like in the Description
+		lines := strings.Split(change, "\n")
+		fmt.Fprintf(&b, "   * %s\n", lines[0])
+		for _, line := range lines[1:] {
+			if strings.TrimSpace(line) == "" {
+				b.WriteString(" .\n")
+				continue
+			}
+			fmt.Fprintf(&b, "     %s\n", line)
+		}
+	}
+
+	b.WriteString("Checksums-Sha1:\n")
+	for _, f := range c.files {
+		fmt.Fprintf(&b, " %s %d %s\n", f.sha1sum, f.size, f.name)
+	}
+	b.WriteString("Checksums-Sha256:\n")
+	for _, f := range c.files {
+		fmt.Fprintf(&b, " %s %d %s\n", f.sha256sum, f.size, f.name)
+	}
+	b.WriteString("Files:\n")
+	for _, f := range c.files {
+		fmt.Fprintf(&b, " %s %d %s %s %s\n", f.md5sum, f.size, f.section, f.priority, f.name)
+	}
+	return b.String()
+}
+
+// Write validates and writes the unsigned .changes file to filename (GetFilename when empty)
+func (c *Changes) Write(filename string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if filename == "" {
+		filename = c.GetFilename()
+	}
+	return fileError("create", "", filename, ioutil.WriteFile(filename, []byte(c.String()), 0644))
+}
+
+// WriteSigned validates and writes the .changes file clearsigned with GPG entity to filename
+// (GetFilename when empty)
+func (c *Changes) WriteSigned(filename string, entity *openpgp.Entity) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if entity == nil || entity.PrivateKey == nil {
+		return fmt.Errorf("missing private key to sign the changes")
+	}
+	if filename == "" {
+		filename = c.GetFilename()
+	}
+
+	var cfg packet.Config
+	cfg.DefaultHash = crypto.SHA256
+	if !c.date.IsZero() {
+		cfg.Time = func() time.Time { return c.date }
+	}
+
+	var buf bytes.Buffer
+	w, err := clearsign.Encode(&buf, entity.PrivateKey, &cfg)
+	if err != nil {
+		return fmt.Errorf("error while signing: %w", err)
+	}
+	if _, err := w.Write([]byte(c.String())); err != nil {
+		return fmt.Errorf("error from Write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error from Close: %w", err)
+	}
+	return fileError("create", "", filename, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+}
+
+// architectures returns the sorted unique architectures of the packages
+func (c *Changes) architectures() []string {
+	var archs []string
+	seen := make(map[string]bool)
+	for _, f := range c.files {
+		if !seen[f.architecture] {
+			seen[f.architecture] = true
+			archs = append(archs, f.architecture)
+		}
+	}
+	sort.Strings(archs)
+	return archs
+}
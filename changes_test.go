@@ -0,0 +1,148 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// testWriteChangesPackage writes a package of source foo to the tempdir and returns the filename
+func testWriteChangesPackage(t *testing.T, name, arch string) string {
+	deb := testNewPkg(name, "1:1.2.3-1", arch)
+	defer deb.Close()
+
+	deb.SetSource("foo")
+	deb.SetShortDescription(name + " package")
+	deb.SetSection("utils")
+	require.Nil(t, deb.AddFileString(name, "/usr/share/"+name))
+
+	require.Nil(t, deb.SetFilenameTemplate(CanonicalFilenameTemplate))
+	filename, err := deb.Filename()
+	require.Nil(t, err)
+	filename = filepath.Join(test.TempDir(), filename)
+	require.Nil(t, deb.Write(filename))
+	return filename
+}
+
+func TestChanges(t *testing.T) {
+	c := NewChanges()
+	assert.NotNil(t, c.Validate())
+
+	foo := testWriteChangesPackage(t, "foo", "amd64")
+	require.Nil(t, c.AddPackage(foo))
+	require.Nil(t, c.AddPackage(testWriteChangesPackage(t, "foo-data", "all")))
+	c.SetDistribution("bookworm")
+	c.SetUrgency("high")
+	c.SetChangedBy("Bar Baz <bar@baz.com>")
+	c.SetDate(time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC))
+	c.SetChanges("Fix crash on startup.", "Add foo-data package,\nwhich ships the icons.\n\nSee the README.")
+	assert.Equal(t, "foo_1.2.3-1_multi.changes", c.GetFilename())
+
+	filename := filepath.Join(test.TempDir(), c.GetFilename())
+	require.Nil(t, c.Write(filename))
+	b, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	changes := string(b)
+
+	assert.True(t, strings.HasPrefix(changes, `Format: 1.8
+Date: Tue, 01 Aug 2017 12:00:00 +0000
+Source: foo
+Binary: foo foo-data
+Architecture: all amd64
+Version: 1:1.2.3-1
+Distribution: bookworm
+Urgency: high
+Maintainer: Foo Bar <foo@bar.com>
+Changed-By: Bar Baz <bar@baz.com>
+Description:
+ foo - foo package
+ foo-data - foo-data package
+Changes:
+ foo (1:1.2.3-1) bookworm; urgency=high
+ .
+   * Fix crash on startup.
+   * Add foo-data package,
+     which ships the icons.
+ .
+     See the README.
+Checksums-Sha1:
+`), changes)
+
+	deb, err := ioutil.ReadFile(foo)
+	require.Nil(t, err)
+	assert.Contains(t, changes, fmt.Sprintf("Checksums-Sha256:\n %x %d foo_1.2.3-1_amd64.deb\n", sha256.Sum256(deb), len(deb)))
+	assert.Contains(t, changes, fmt.Sprintf(" %d utils optional foo_1.2.3-1_amd64.deb\n", len(deb)))
+
+	fields, err := parseControlFields(changes)
+	require.Nil(t, err)
+	assert.Equal(t, "foo", fields["source"])
+}
+
+func TestChangesSigned(t *testing.T) {
+	c := NewChanges()
+	require.Nil(t, c.AddPackage(testWriteChangesPackage(t, "foo", "amd64")))
+	assert.Equal(t, "foo_1.2.3-1_amd64.changes", c.GetFilename())
+
+	filename := filepath.Join(test.TempDir(), c.GetFilename())
+	require.Nil(t, c.WriteSigned(filename, e))
+	b, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+
+	block, _ := clearsign.Decode(b)
+	require.NotNil(t, block)
+	assert.Contains(t, string(block.Plaintext), "Urgency: medium\n")
+	assert.Contains(t, string(block.Plaintext), "   * Upload of foo 1:1.2.3-1.\n")
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	assert.Nil(t, err)
+
+	assert.NotNil(t, c.WriteSigned(filename, nil))
+}
+
+func TestChangesValidate(t *testing.T) {
+	c := NewChanges()
+	require.Nil(t, c.AddPackage(testWriteChangesPackage(t, "foo", "amd64")))
+
+	var verr *ValidationError
+	c.SetUrgency("urgent")
+	err := c.Write(filepath.Join(test.TempDir(), "invalid.changes"))
+	if assert.True(t, errors.As(err, &verr)) {
+		assert.Equal(t, "Urgency", verr.Field)
+	}
+
+	c.SetUrgency("low")
+	c.SetDistribution("")
+	if assert.True(t, errors.As(c.Validate(), &verr)) {
+		assert.Equal(t, "Distribution", verr.Field)
+	}
+
+	c.SetDistribution("unstable")
+	deb := New()
+	defer deb.Close()
+	deb.SetName("bar")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+	bar := filepath.Join(test.TempDir(), "changes-bar.deb")
+	require.Nil(t, deb.Write(bar))
+	require.Nil(t, c.AddPackage(bar))
+	if assert.True(t, errors.As(c.Validate(), &verr)) {
+		assert.Equal(t, "Source", verr.Field)
+	}
+
+	assert.True(t, errors.Is(c.AddPackage("does-not-exist.deb"), ErrIO))
+}
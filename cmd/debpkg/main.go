@@ -5,36 +5,73 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/xor-gate/debpkg"
 )
 
 var (
-	outputFile    string
-	configFile    string
-	versionNumber string
+	outputFile       string
+	configFile       string
+	versionNumber    string
+	filenameTemplate string
 )
 
 func init() {
 	flag.StringVar(&configFile, "c", "debpkg.yml",
 		"YAML configuration file")
 	flag.StringVar(&outputFile, "o", "",
-		"Debian output file")
+		"Debian output file or directory (the filename is generated when it is a directory)")
 	flag.StringVar(&versionNumber, "v", os.Getenv("DEBPKG_VERSION"),
 		"Package version number (or via DEBPKG_VERSION environment variable)")
-	flag.Parse()
+	flag.StringVar(&filenameTemplate, "t", "",
+		"Filename template for a generated filename (e.g \""+debpkg.CanonicalFilenameTemplate+"\")")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "repo" {
+		if err := runRepo(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	flag.Parse()
+
+	filename, err := run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("debpkg: written:", filename)
+}
+
+// run builds the package from the flags and returns the written filename
+func run() (string, error) {
 	deb := debpkg.New()
+	defer deb.Close()
+
 	if err := deb.Config(configFile); err != nil {
-		log.Fatalf("Error while loading config file: %v", err)
+		return "", fmt.Errorf("Error while loading config file: %w", err)
 	}
 	if versionNumber != "" {
 		deb.SetVersion(versionNumber)
 	}
-	if err := deb.Write(outputFile); err != nil {
-		log.Fatalf("Error writing outputfile: %v", err)
+	if filenameTemplate != "" {
+		if err := deb.SetFilenameTemplate(filenameTemplate); err != nil {
+			return "", fmt.Errorf("Error in filename template: %w", err)
+		}
+	}
+
+	filename := outputFile
+	if fi, err := os.Stat(outputFile); outputFile == "" || strings.HasSuffix(outputFile, "/") || (err == nil && fi.IsDir()) {
+		name, err := deb.Filename()
+		if err != nil {
+			return "", fmt.Errorf("Error in filename template: %w", err)
+		}
+		filename = filepath.Join(outputFile, name)
+	}
+	if err := deb.Write(filename); err != nil {
+		return "", fmt.Errorf("Error writing outputfile: %w", err)
 	}
-	fmt.Println("debpkg: written:", outputFile)
+	return filename, nil
 }
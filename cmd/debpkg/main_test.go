@@ -1,13 +1,32 @@
 package main
 
 import (
+	"flag"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
 )
 
+const testConfig = `name: foo
+version: 1:1.2.3
+architecture: amd64
+description:
+  short: foo package
+`
+
+func writeTestConfig(t *testing.T, dir string) string {
+	filename := filepath.Join(dir, "debpkg.yml")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(testConfig), 0644))
+	return filename
+}
+
 func TestMainHappyFlow(t *testing.T) {
 	configFile = "/dev/null"
 	f, err := ioutil.TempFile("", "debpkg")
@@ -20,3 +39,85 @@ func TestMainHappyFlow(t *testing.T) {
 	main()
 	// we should get here without fatal errors
 }
+
+func TestMainOutputDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debpkg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile = writeTestConfig(t, dir)
+	outputFile = dir
+	filenameTemplate = ""
+	main()
+	_, err = os.Stat(filepath.Join(dir, "foo-1.2.3_amd64.deb"))
+	assert.Nil(t, err)
+}
+
+func TestMainFilenameTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debpkg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func() { filenameTemplate = "" }()
+
+	config := writeTestConfig(t, dir)
+	require.Nil(t, flag.CommandLine.Parse([]string{"-c", config, "-o", dir + "/",
+		"-t", "{{.Package}}-{{.FullVersion}}.{{index .Fields \"Architecture\"}}.{{.Extension}}"}))
+	filename, err := run()
+	require.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "foo-1:1.2.3.amd64.deb"), filename)
+	_, err = os.Stat(filename)
+	assert.Nil(t, err)
+
+	require.Nil(t, flag.CommandLine.Parse([]string{"-t", "{{.Package}}/{{.Version}}.deb"}))
+	_, err = run()
+	assert.NotNil(t, err)
+	require.Nil(t, flag.CommandLine.Parse([]string{"-t", "{{.Package}}_{{index .Fields 1}}.deb"}))
+	_, err = run()
+	assert.NotNil(t, err)
+}
+
+func TestRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debpkg")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pool := filepath.Join(dir, "pool", "main")
+	require.Nil(t, os.MkdirAll(pool, 0755))
+	configFile = writeTestConfig(t, dir)
+	outputFile = pool
+	filenameTemplate = debpkg.CanonicalFilenameTemplate
+	defer func() { filenameTemplate = "" }()
+	main()
+
+	require.Nil(t, runRepo([]string{"-suite", "nightly", dir}))
+	packages, err := ioutil.ReadFile(filepath.Join(dir, "dists", "nightly", "main", "binary-amd64", "Packages"))
+	require.Nil(t, err)
+	assert.Contains(t, string(packages), "Filename: pool/main/foo_1.2.3_amd64.deb\n")
+
+	// Sign with an armored private key
+	e, err := openpgp.NewEntity("Debpkg Authors", "", "debpkg-authors@xor-gate.org", nil)
+	require.Nil(t, err)
+	keyFile := filepath.Join(dir, "key.asc")
+	f, err := os.Create(keyFile)
+	require.Nil(t, err)
+	w, err := armor.Encode(f, openpgp.PrivateKeyType, nil)
+	require.Nil(t, err)
+	require.Nil(t, e.SerializePrivate(w, nil))
+	require.Nil(t, w.Close())
+	require.Nil(t, f.Close())
+
+	require.Nil(t, runRepo([]string{"-suite", "nightly", "-k", keyFile, dir}))
+	_, err = os.Stat(filepath.Join(dir, "dists", "nightly", "InRelease"))
+	assert.Nil(t, err)
+
+	assert.NotNil(t, runRepo([]string{"-k", filepath.Join(dir, "missing.asc"), dir}))
+
+	// Incremental updates in the pool layout
+	require.Nil(t, runRepo([]string{"-suite", "nightly", "-by-hash", "-include", filepath.Join(pool, "foo_1.2.3_amd64.deb"), dir}))
+	_, err = os.Stat(filepath.Join(pool, "f", "foo", "foo_1.2.3_amd64.deb"))
+	assert.Nil(t, err)
+	require.Nil(t, runRepo([]string{"-suite", "nightly", "-remove", "foo=1:1.2.3", dir}))
+	_, err = os.Stat(filepath.Join(pool, "f", "foo", "foo_1.2.3_amd64.deb"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NotNil(t, runRepo([]string{"-suite", "nightly", "-remove", "foo", dir}))
+}
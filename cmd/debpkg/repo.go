@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xor-gate/debpkg/repo"
+	"golang.org/x/crypto/openpgp"
+)
+
+// listFlag is a flag which may be given multiple times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runRepo generates the indices of the APT repository, args are the arguments after "debpkg repo".
+// The pool is scanned unless packages are included or removed.
+func runRepo(args []string) error {
+	var release repo.Release
+	var pool, component, arch, keyFile string
+	var include, remove listFlag
+	var retain int
+
+	fs := flag.NewFlagSet("debpkg repo", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: debpkg repo [flags] [root directory]\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&pool, "pool", "pool", "Pool directory relative to the root which is scanned for packages")
+	fs.StringVar(&component, "component", repo.DefaultComponent, "Component of the packages in the pool")
+	fs.StringVar(&release.Suite, "suite", "stable", "Suite written to dists/<suite>")
+	fs.StringVar(&release.Codename, "codename", "", "Codename of the suite")
+	fs.StringVar(&release.Origin, "origin", "", "Origin of the repository")
+	fs.StringVar(&release.Label, "label", "", "Label of the repository")
+	fs.StringVar(&release.Description, "description", "", "Description of the suite")
+	fs.StringVar(&arch, "arch", "", "Comma separated architectures (defaults to the architectures of the packages)")
+	fs.Var(&include, "include", "Copy the package into the pool layout and add it (may be repeated)")
+	fs.Var(&remove, "remove", "Remove the package name or name=version from the component and the pool (may be repeated)")
+	fs.IntVar(&retain, "retain", -1, "Amount of older versions kept per package (all when negative)")
+	fs.BoolVar(&release.AcquireByHash, "by-hash", false, "Publish the indices in by-hash directories")
+	fs.StringVar(&keyFile, "k", "", "Armored OpenPGP private key to sign the Release file "+
+		"(passphrase via DEBPKG_PASSPHRASE environment variable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root := "."
+	if fs.NArg() > 0 {
+		root = fs.Arg(0)
+	}
+	if arch != "" {
+		release.Architectures = strings.Split(arch, ",")
+	}
+
+	r, err := repo.Open(root, release)
+	if err != nil {
+		return err
+	}
+	r.SetRetain(retain)
+	for _, filename := range include {
+		if err := r.Include(filename, component); err != nil {
+			return err
+		}
+	}
+	for _, name := range remove {
+		version := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, version = name[:i], name[i+1:]
+		}
+		if err := r.Remove(component, name, version); err != nil {
+			return err
+		}
+	}
+	if len(include) == 0 && len(remove) == 0 {
+		if err := r.AddPool(pool, component); err != nil {
+			return fmt.Errorf("Error while scanning pool: %w", err)
+		}
+	}
+	if keyFile == "" {
+		return r.Write()
+	}
+
+	entity, err := readSigningKey(keyFile, os.Getenv("DEBPKG_PASSPHRASE"))
+	if err != nil {
+		return fmt.Errorf("Error while reading signing key: %w", err)
+	}
+	return r.WriteSigned(entity)
+}
+
+// readSigningKey reads the first private key from the armored keyring file and decrypts it with passphrase
+func readSigningKey(filename, passphrase string) (*openpgp.Entity, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+		return entity, nil
+	}
+	return nil, fmt.Errorf("no private key in %s", filename)
+}
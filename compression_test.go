@@ -0,0 +1,104 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+// testWriteConcurrency writes a package with content compressed by the amount of workers
+func testWriteConcurrency(t *testing.T, c Compression, workers int, content []byte) []byte {
+	deb := NewInMemory()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-concurrency")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.SetReproducible(true))
+	require.Nil(t, deb.SetCompression(c))
+	require.Nil(t, deb.SetCompressionConcurrency(workers))
+	require.Nil(t, deb.AddFileString(string(content), "/usr/share/foo/data"))
+
+	var buf bytes.Buffer
+	_, err := deb.WriteTo(&buf)
+	require.Nil(t, err)
+	return buf.Bytes()
+}
+
+// TestCompressionConcurrency verifies parallel compressed packages are readable by dpkg and debpkg and the
+// output does not depend on the amount of workers
+func TestCompressionConcurrency(t *testing.T) {
+	content := test.CompressibleData(10<<20 + 12345)
+	for _, c := range []Compression{CompressionGzip, CompressionXz, CompressionZstd} {
+		b := testWriteConcurrency(t, c, 4, content)
+
+		f := test.TempDir() + string(os.PathSeparator) + t.Name() + "-" + string(c) + ".deb"
+		require.Nil(t, ioutil.WriteFile(f, b, 0644))
+		testReadWithNativeDpkg(t, f)
+		if c != CompressionZstd {
+			assert.Equal(t, b, testWriteConcurrency(t, c, 2, content), "compression %s", c)
+		}
+
+		r, err := OpenReader(bytes.NewReader(b))
+		require.Nil(t, err)
+		it, err := r.Data()
+		require.Nil(t, err)
+		var data []byte
+		for {
+			hdr, err := it.Next()
+			if err != nil {
+				break
+			}
+			if hdr.Name == "usr/share/foo/data" {
+				data, err = ioutil.ReadAll(it)
+				require.Nil(t, err)
+			}
+		}
+		it.Close()
+		r.Close()
+		assert.True(t, bytes.Equal(content, data), "compression %s", c)
+	}
+}
+
+// BenchmarkCompressionConcurrency measures the scaling of the data archive compression with the amount of workers
+func BenchmarkCompressionConcurrency(b *testing.B) {
+	content := string(test.CompressibleData(32 << 20))
+	for _, c := range []Compression{CompressionGzip, CompressionXz, CompressionZstd} {
+		for _, workers := range []int{1, 2, 4, 8, 16, 32} {
+			b.Run(fmt.Sprintf("%s-%d", c, workers), func(b *testing.B) {
+				b.SetBytes(int64(len(content)))
+				for i := 0; i < b.N; i++ {
+					deb := NewInMemory()
+					deb.SetName("debpkg-bench")
+					testSetMaintainer(deb)
+					deb.SetArchitecture("all")
+					if err := deb.SetCompression(c); err != nil {
+						b.Fatal(err)
+					}
+					if err := deb.SetCompressionConcurrency(workers); err != nil {
+						b.Fatal(err)
+					}
+					if err := deb.AddFileString(content, "/usr/share/foo/data"); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := deb.WriteTo(ioutil.Discard); err != nil {
+						b.Fatal(err)
+					}
+					if err := deb.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
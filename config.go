@@ -7,73 +7,176 @@ package debpkg
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xor-gate/debpkg/internal/config"
+	"github.com/xor-gate/debpkg/internal/glob"
 )
 
-// Config loads settings from a depkg.yml specfile
+// Config loads settings from a depkg.yml specfile. Problems in the specfile are returned as *SpecError
+// pointing to the entry, which wraps the cause. E.g: a *FileError for a missing file.
 func (deb *DebPkg) Config(filename string) error {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("problem reading config file: %v", err)
+		return &FileError{Op: "read specfile", Src: filename, Err: err}
 	}
 
 	dataExpanded, err := ExpandVar(string(data))
 	if err != nil {
-		return err
+		return &SpecError{File: filename, Err: err}
 	}
 
 	cfg, err := config.PkgSpecFileUnmarshal([]byte(dataExpanded))
 	if err != nil {
-		return err
+		return &SpecError{File: filename, Line: config.ErrorLine(err), Err: err}
+	}
+
+	// specError reports the key, or the index-th entry of the key when the index is not negative
+	specError := func(key string, index int, err error) error {
+		field := key
+		if index >= 0 {
+			field = fmt.Sprintf("%s[%d]", key, index)
+		}
+		line, column := cfg.Position(key, index)
+		return &SpecError{File: filename, Line: line, Column: column, Field: field, Err: err}
+	}
+
+	if cfg.Compression != "" {
+		if err := deb.SetCompression(Compression(cfg.Compression)); err != nil {
+			return specError("compression", -1, err)
+		}
+	}
+	if cfg.CompressionWorkers != nil {
+		if err := deb.SetCompressionConcurrency(*cfg.CompressionWorkers); err != nil {
+			return specError("compression_concurrency", -1, err)
+		}
 	}
 
 	deb.SetSection(cfg.Section)
 	deb.SetPriority(Priority(cfg.Priority))
 	deb.SetName(cfg.Name)
 	deb.SetVersion(cfg.Version)
-	deb.SetArchitecture(cfg.Architecture)
+	if cfg.Architecture != "" {
+		deb.SetArchitecture(cfg.Architecture)
+	} else {
+		deb.SetArchitecture(GetArchitecture())
+	}
 	deb.SetMaintainer(cfg.Maintainer)
 	deb.SetMaintainerEmail(cfg.MaintainerEmail)
 	deb.SetHomepage(cfg.Homepage)
 	deb.SetShortDescription(cfg.Description.Short)
 	deb.SetDescription(cfg.Description.Long)
 	deb.SetBuiltUsing(cfg.BuiltUsing)
-	deb.SetDepends(cfg.Depends)
-	deb.SetRecommends(cfg.Recommends)
-	deb.SetSuggests(cfg.Suggests)
-	deb.SetConflicts(cfg.Conflicts)
-	deb.SetProvides(cfg.Provides)
-	deb.SetReplaces(cfg.Replaces)
-
-	for _, file := range cfg.Files {
+	deb.SetDepends(string(cfg.Depends))
+	deb.SetRecommends(string(cfg.Recommends))
+	deb.SetSuggests(string(cfg.Suggests))
+	deb.SetConflicts(string(cfg.Conflicts))
+	deb.SetProvides(string(cfg.Provides))
+	deb.SetReplaces(string(cfg.Replaces))
+	deb.SetPreDepends(string(cfg.PreDepends))
+	deb.SetBreaks(string(cfg.Breaks))
+	deb.SetEnhances(string(cfg.Enhances))
+	deb.SetStaticBuiltUsing(cfg.StaticBuiltUsing)
+	deb.SetEssential(cfg.Essential)
+	deb.SetProtected(cfg.Protected)
+	deb.SetMultiArch(MultiArch(cfg.MultiArch))
+	deb.SetSource(cfg.Source)
+	deb.SetOriginalMaintainer(cfg.OriginalMaintainer)
+	deb.SetRulesRequiresRoot(cfg.RulesRequiresRoot)
+	deb.SetBugs(cfg.Bugs)
+	deb.SetPackageType(PackageType(cfg.PackageType))
+	deb.SetBuildIDs(cfg.BuildIDs...)
+	if err := deb.SetFilenameTemplate(cfg.FilenameTemplate); err != nil {
+		return specError("filename_template", -1, err)
+	}
+
+	if cfg.Changelog.File != "" || len(cfg.Changelog.Entries) > 0 {
+		changelog, err := configChangelog(cfg, specError)
+		if err != nil {
+			return err
+		}
+		// The version and maintainer default to the newest entry when they are not in the specfile
+		if !cfg.Has("version") {
+			deb.SetVersion("")
+		}
+		if !cfg.Has("maintainer") && !cfg.Has("maintainer_email") {
+			deb.SetMaintainer("")
+			deb.SetMaintainerEmail("")
+		}
+		if err := deb.SetChangelog(changelog); err != nil {
+			return specError("changelog", -1, err)
+		}
+	}
+
+	if cfg.Copyright.File != "" || len(cfg.Copyright.Files) > 0 {
+		copyright, err := configCopyright(cfg, specError)
+		if err != nil {
+			return err
+		}
+		if err := deb.SetCopyright(copyright); err != nil {
+			return specError("copyright", -1, err)
+		}
+	}
+
+	for i, field := range cfg.CustomFields {
+		if err := deb.SetCustomField(fmt.Sprint(field.Key), fmt.Sprint(field.Value)); err != nil {
+			return specError("custom_fields", i, err)
+		}
+	}
+
+	for i, file := range cfg.Files {
+		attr, err := configFileAttributes(file.Mode, file.Owner, file.Group)
+		if err != nil {
+			return specError("files", i, err)
+		}
+		if _, err := os.Lstat(file.File); err != nil && glob.HasMeta(file.File) {
+			if err := deb.configFileGlob(file.File, file.Dest, attr, file.ConfigFile); err != nil {
+				return specError("files", i, err)
+			}
+			continue
+		}
 		if len(file.File) > 0 {
-			if err := deb.AddFile(file.File, file.Dest); err != nil {
-				return fmt.Errorf("error adding file %s: %v", file.File, err)
+			if err := deb.AddFileWithAttributes(file.File, file.Dest, attr); err != nil {
+				return specError("files", i, err)
 			}
 		} else if len(file.Content) > 0 {
-			if err := deb.AddFileString(file.Content, file.Dest); err != nil {
-				return fmt.Errorf("error adding file by string: %v", err)
+			if err := deb.AddFileStringWithAttributes(file.Content, file.Dest, attr); err != nil {
+				return specError("files", i, err)
 			}
 		} else {
-			return fmt.Errorf("need either 'content' or a 'src' to add a file")
+			return specError("files", i, fmt.Errorf("need either 'content' or a 'src' to add a file"))
 		}
 		if file.ConfigFile {
 			deb.MarkConfigFile(file.Dest)
 		}
 	}
 
-	for _, dir := range cfg.Directories {
-		if err := deb.AddDirectory(dir); err != nil {
-			return fmt.Errorf("error adding directory %s: %v", dir, err)
+	for i, link := range cfg.Symlinks {
+		if err := deb.AddSymlink(link.Target, link.Dest); err != nil {
+			return specError("symlinks", i, err)
 		}
 	}
 
-	for _, dir := range cfg.EmptyDirectories {
-		err := deb.AddEmptyDirectory(dir)
-		if err != nil {
-			return fmt.Errorf("error adding directory %s: %v", dir, err)
+	for i, dir := range cfg.Directories {
+		opts := DirectoryOptions{
+			Dest:           dir.Dest,
+			Include:        dir.Include,
+			Exclude:        dir.Exclude,
+			IgnoreFile:     dir.IgnoreFile,
+			FollowSymlinks: dir.FollowSymlinks,
+		}
+		if err := deb.AddDirectoryWithOptions(dir.Src, opts); err != nil {
+			return specError("directories", i, err)
+		}
+	}
+
+	for i, dir := range cfg.EmptyDirectories {
+		if err := deb.AddEmptyDirectory(dir); err != nil {
+			return specError("emptydirs", i, err)
 		}
 	}
 
@@ -110,3 +213,143 @@ func (deb *DebPkg) Config(filename string) error {
 	}
 	return nil
 }
+
+// configChangelog reads the changelog file or builds the changelog from the entries of the source package,
+// the distribution defaults to "unstable" and the urgency to "medium"
+func configChangelog(cfg *config.PkgSpecFile, specError func(string, int, error) error) (*Changelog, error) {
+	if cfg.Changelog.File != "" {
+		changelog, err := ReadChangelog(cfg.Changelog.File)
+		if err != nil {
+			return nil, specError("changelog", -1, err)
+		}
+		return changelog, nil
+	}
+
+	name := cfg.Name
+	if source := strings.Fields(cfg.Source); len(source) > 0 {
+		name = source[0]
+	}
+	changelog := &Changelog{}
+	for i, e := range cfg.Changelog.Entries {
+		entry := ChangelogEntry{
+			Package:      name,
+			Version:      e.Version,
+			Distribution: e.Distribution,
+			Urgency:      e.Urgency,
+			Changes:      e.Changes,
+			Author:       e.Author,
+		}
+		if entry.Distribution == "" {
+			entry.Distribution = "unstable"
+		}
+		if entry.Urgency == "" {
+			entry.Urgency = "medium"
+		}
+		date, err := time.Parse(changelogDateLayout, e.Date)
+		if err != nil {
+			return nil, specError("changelog", i, fmt.Errorf("invalid date %q: %w", e.Date, err))
+		}
+		entry.Date = date
+		changelog.Entries = append(changelog.Entries, entry)
+	}
+	return changelog, nil
+}
+
+// configCopyright reads the copyright file or builds the copyright from the paragraphs, the license text is
+// read from the text_file when set
+func configCopyright(cfg *config.PkgSpecFile, specError func(string, int, error) error) (*Copyright, error) {
+	if cfg.Copyright.File != "" {
+		copyright, err := ReadCopyright(cfg.Copyright.File)
+		if err != nil {
+			return nil, specError("copyright", -1, err)
+		}
+		return copyright, nil
+	}
+
+	copyright := &Copyright{
+		UpstreamName:    cfg.Copyright.UpstreamName,
+		UpstreamContact: cfg.Copyright.UpstreamContact,
+		Source:          cfg.Copyright.Source,
+	}
+	for _, f := range cfg.Copyright.Files {
+		copyright.Files = append(copyright.Files, CopyrightFiles{
+			Files:       f.Files,
+			Copyright:   f.Copyright,
+			License:     f.License,
+			LicenseText: f.LicenseText,
+			Comment:     f.Comment,
+		})
+	}
+	for _, l := range cfg.Copyright.Licenses {
+		text := l.Text
+		if l.TextFile != "" {
+			b, err := ioutil.ReadFile(l.TextFile)
+			if err != nil {
+				return nil, specError("copyright", -1, &FileError{Op: "read license", Src: l.TextFile, Err: err})
+			}
+			text = string(b)
+		}
+		copyright.Licenses = append(copyright.Licenses, CopyrightLicense{License: l.License, Text: text, Comment: l.Comment})
+	}
+	return copyright, nil
+}
+
+// configFileGlob adds the files matching the pattern. E.g: "dist/bin/*" or "share/**/*.1". The path below the
+// leading directories without magic characters is kept under the dest directory (the matched path when dest is empty).
+func (deb *DebPkg) configFileGlob(pattern, dest string, attr FileAttributes, conffile bool) error {
+	base, names, err := glob.Files(pattern)
+	if err != nil {
+		return fmt.Errorf("error matching files %s: %w", pattern, err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("pattern %s matches no files", pattern)
+	}
+	for _, name := range names {
+		filename := path.Join(base, name)
+		destfilename := filename
+		if dest != "" {
+			destfilename = path.Join(dest, name)
+		}
+		if err := deb.AddFileWithAttributes(filename, destfilename, attr); err != nil {
+			return err
+		}
+		if conffile {
+			deb.MarkConfigFile(destfilename)
+		}
+	}
+	return nil
+}
+
+// configFileAttributes parses the specfile octal mode, owner and group (name or numeric id)
+func configFileAttributes(mode, owner, group string) (FileAttributes, error) {
+	var attr FileAttributes
+
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m > 07777 {
+			return attr, fmt.Errorf("invalid mode %q", mode)
+		}
+		attr.Mode = os.FileMode(m & 0777)
+		if m&04000 != 0 {
+			attr.Mode |= os.ModeSetuid
+		}
+		if m&02000 != 0 {
+			attr.Mode |= os.ModeSetgid
+		}
+		if m&01000 != 0 {
+			attr.Mode |= os.ModeSticky
+		}
+	}
+	if id, err := strconv.Atoi(owner); err == nil {
+		attr.Uid = id
+	} else {
+		attr.Owner = owner
+	}
+	if id, err := strconv.Atoi(group); err == nil {
+		attr.Gid = id
+	} else {
+		attr.Group = group
+	}
+
+	return attr, nil
+}
@@ -5,10 +5,15 @@
 package debpkg
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xor-gate/debpkg/internal/test"
 )
 
@@ -164,6 +169,63 @@ files:
 	assert.Nil(t, testWrite(t, deb))
 }
 
+func TestExampleConfigWithSymlinks(t *testing.T) {
+	const configFile = `name: foo-symlinks
+version: 1.2.3
+architecture: all
+files:
+  - dest: /opt/foo/bin/foo
+    content: foo
+symlinks:
+  - target: /opt/foo/bin/foo
+    dest: /usr/bin/foo
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Equal(t, "acbd18db4cc2f85cedef654fccc4a4d8  opt/foo/bin/foo\n", deb.data.md5sums)
+	assert.Contains(t, deb.data.dirs, "/usr/bin")
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithFileAttributes(t *testing.T) {
+	const configFile = `name: foo-attributes
+version: 1.2.3
+architecture: all
+files:
+  - file: Makefile
+    dest: /usr/bin/foo
+    mode: 4755
+  - dest: /etc/foo.conf
+    content: foo
+    mode: "0640"
+    owner: foo
+    group: 42
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Nil(t, testWrite(t, deb))
+
+	attr, err := configFileAttributes("2775", "0", "adm")
+	assert.Nil(t, err)
+	assert.Equal(t, FileAttributes{Mode: 0775 | os.ModeSetgid, Group: "adm"}, attr)
+
+	_, err = configFileAttributes("rwx", "", "")
+	assert.NotNil(t, err)
+	_, err = configFileAttributes("17777", "", "")
+	assert.NotNil(t, err)
+}
+
 func TestDefaultConfig(t *testing.T) {
 	filepath, err := test.WriteTempFile(t.Name()+".yml", "")
 	assert.Nil(t, err)
@@ -173,7 +235,7 @@ func TestDefaultConfig(t *testing.T) {
 
 	assert.Nil(t, deb.Config(filepath))
 
-	assert.Equal(t, "any", deb.control.info.architecture,
+	assert.Equal(t, GetArchitecture(), deb.control.info.architecture,
 		"unexpected architecture")
 	assert.Equal(t, "anonymous", deb.control.info.maintainer,
 		"unexpected maintainer")
@@ -227,3 +289,307 @@ foo: {{.bar}}
 	assert.Nil(t, err)
 	assert.NotNil(t, deb.Config(filepath))
 }
+
+func TestExampleConfigWithDirectories(t *testing.T) {
+	const configFile = `name: foo-directories
+version: 1.2.3
+architecture: all
+directories:
+  - ./internal/glob
+  - src: ./internal
+    dest: /usr/share/foo
+    include:
+      - "**/*.go"
+    exclude:
+      - test/
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Contains(t, deb.data.md5sums, "  internal/glob/glob.go\n")
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/config/config.go\n")
+	assert.NotContains(t, deb.data.md5sums, "usr/share/foo/test/")
+	assert.NotContains(t, deb.data.dirs, "/usr/share/foo/test")
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithFileGlobs(t *testing.T) {
+	const configFile = `name: foo-globs
+version: 1.2.3
+architecture: all
+files:
+  - file: internal/glob/*.go
+    dest: /usr/share/foo
+  - file: ./internal/**/compress.go
+    dest: /usr/share/bar
+  - file: internal/config/c?nfig.go
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/glob.go\n")
+	assert.Contains(t, deb.data.md5sums, "  usr/share/bar/targzip/compress.go\n")
+	assert.Contains(t, deb.data.md5sums, "  internal/config/config.go\n")
+	assert.Equal(t, 3, strings.Count(deb.data.md5sums, "\n"))
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithFileGlobSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), t.Name())
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(dir+"/share/doc", 0755))
+	require.Nil(t, ioutil.WriteFile(dir+"/share/doc/foo.txt", []byte("foo"), 0644))
+	require.Nil(t, ioutil.WriteFile(dir+"/foo[1.txt", []byte("foo"), 0644))
+	require.Nil(t, os.Symlink("doc/foo.txt", dir+"/share/link.txt"))
+	require.Nil(t, os.Symlink("doc", dir+"/share/linkdir"))
+
+	configFile := "name: foo-globs\nversion: 1.2.3\narchitecture: all\nfiles:\n" +
+		"  - file: " + dir + "/share/**/*.txt\n    dest: /usr/share/foo\n" +
+		"  - file: " + dir + "/foo[1.txt\n    dest: /usr/share/foo/foo[1.txt\n"
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	require.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/doc/foo.txt\n")
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/link.txt\n")
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/linkdir/foo.txt\n")
+	assert.Contains(t, deb.data.md5sums, "  usr/share/foo/foo[1.txt\n")
+	assert.Equal(t, 4, strings.Count(deb.data.md5sums, "\n"))
+
+	// A dangling symlink which matches is reported
+	require.Nil(t, os.Symlink("missing.txt", dir+"/share/dangling.txt"))
+	deb = New()
+	defer deb.Close()
+	assert.NotNil(t, deb.Config(filepath))
+}
+
+// TestExampleConfigWithFileGlobDepth verifies directories deeper than the pattern are not read
+func TestExampleConfigWithFileGlobDepth(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), t.Name())
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.MkdirAll(dir+"/bin/sub", 0755))
+	require.Nil(t, ioutil.WriteFile(dir+"/bin/foo", []byte("foo"), 0755))
+	require.Nil(t, ioutil.WriteFile(dir+"/bin/sub/bar", []byte("bar"), 0755))
+	require.Nil(t, os.Symlink(".", dir+"/bin/loop"))
+	require.Nil(t, os.Symlink("self", dir+"/bin/sub/self"))
+
+	configFile := "name: foo-globs\nversion: 1.2.3\narchitecture: all\nfiles:\n" +
+		"  - file: " + dir + "/bin/*\n    dest: /usr/bin\n"
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	require.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Contains(t, deb.data.md5sums, "  usr/bin/foo\n")
+	assert.Equal(t, 1, strings.Count(deb.data.md5sums, "\n"))
+}
+
+func TestExampleConfigWithFileGlobNoMatch(t *testing.T) {
+	const configFile = `name: foo-globs
+files:
+  - file: dist/bin/*
+    dest: /usr/bin
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	err = deb.Config(filepath)
+	assert.EqualError(t, err, filepath+":3:5: files[0]: pattern dist/bin/* matches no files")
+}
+
+func TestExampleConfigWithRelationLists(t *testing.T) {
+	const configFile = `name: foo-relations
+version: 1.2.3
+architecture: all
+depends:
+  - libc6 (>= 2.31)
+  - default-mta | mail-transport-agent
+conflicts: pico
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Equal(t, "libc6 (>= 2.31), default-mta | mail-transport-agent", deb.control.info.depends)
+	assert.Equal(t, "pico", deb.control.info.conflicts)
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithExtraFields(t *testing.T) {
+	const configFile = `name: libfoo1
+version: 1.2.3
+architecture: amd64
+pre_depends: dpkg (>= 1.17.14)
+breaks: libfoo0 (<< 1.0)
+enhances: bar
+static_built_using: golang-1.22 (= 1.22.0-1)
+multi_arch: same
+source: foo
+original_maintainer: Bar Foo <bar@foo.com>
+rules_requires_root: "no"
+bugs: https://github.com/xor-gate/debpkg/issues
+protected: true
+custom_fields:
+  XB-Foo-Build: 42
+  X-Foo: bar
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	control := deb.control.String(0)
+	assert.Contains(t, control, "Pre-Depends: dpkg (>= 1.17.14)\n")
+	assert.Contains(t, control, "Breaks: libfoo0 (<< 1.0)\n")
+	assert.Contains(t, control, "Enhances: bar\n")
+	assert.Contains(t, control, "Static-Built-Using: golang-1.22 (= 1.22.0-1)\n")
+	assert.Contains(t, control, "Multi-Arch: same\n")
+	assert.Contains(t, control, "Source: foo\n")
+	assert.Contains(t, control, "Original-Maintainer: Bar Foo <bar@foo.com>\n")
+	assert.Contains(t, control, "Rules-Requires-Root: no\n")
+	assert.Contains(t, control, "Bugs: https://github.com/xor-gate/debpkg/issues\n")
+	assert.Contains(t, control, "Protected: yes\n")
+	assert.NotContains(t, control, "Essential:")
+	assert.True(t, strings.HasSuffix(control, "Foo-Build: 42\nX-Foo: bar\n"))
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithPackageType(t *testing.T) {
+	const configFile = `name: foo-udeb
+version: 1.2.3
+architecture: amd64
+package_type: ddeb
+build_ids:
+  - 3a5e2b1c
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Equal(t, "foo-udeb-1.2.3_amd64.ddeb", deb.GetFilename())
+	assert.Contains(t, deb.control.String(0), "Build-Ids: 3a5e2b1c\n")
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithChangelog(t *testing.T) {
+	const configFile = `name: foo
+architecture: all
+changelog:
+  - version: 1.1.0-1
+    urgency: low
+    changes:
+      - Fix crash on startup.
+    author: Foo Bar <foo@bar.com>
+    date: Tue, 01 Aug 2017 12:00:00 +0000
+  - version: 1.0.0-1
+    author: Foo Bar <foo@bar.com>
+    date: Mon, 31 Jul 2017 12:00:00 +0000
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	assert.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Equal(t, "foo-1.1.0-1_all.deb", deb.GetFilename())
+	assert.Contains(t, deb.control.String(0), "Maintainer: Foo Bar <foo@bar.com>\n")
+	assert.Equal(t, "unstable", deb.changelog.Entries[1].Distribution)
+	assert.Equal(t, "medium", deb.changelog.Entries[1].Urgency)
+
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestExampleConfigWithChangelogFile(t *testing.T) {
+	changelog, err := test.WriteTempFile(t.Name()+".changelog", "foo (2.0.0-1) unstable; urgency=medium\n\n"+
+		"  * Initial release.\n\n -- Foo Bar <foo@bar.com>  Tue, 01 Aug 2017 12:00:00 +0000\n")
+	require.Nil(t, err)
+	filepath, err := test.WriteTempFile(t.Name()+".yml", "name: foo\n\"version\": 2.0.1\nchangelog: "+changelog+"\n")
+	require.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	assert.Equal(t, "foo-2.0.1_"+GetArchitecture()+".deb", deb.GetFilename())
+	assert.Contains(t, deb.control.String(0), "Maintainer: Foo Bar <foo@bar.com>\n")
+
+	filepath, err = test.WriteTempFile(t.Name()+"-invalid.yml", "name: foo\nchangelog:\n  - version: 1.0\n    date: 2017-08-01\n")
+	require.Nil(t, err)
+	var serr *SpecError
+	if assert.True(t, errors.As(deb.Config(filepath), &serr)) {
+		assert.Equal(t, "changelog[0]", serr.Field)
+	}
+}
+
+func TestExampleConfigWithCopyright(t *testing.T) {
+	license, err := test.WriteTempFile(t.Name()+".LICENSE", "Permission is hereby granted, free of charge.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\".\n")
+	require.Nil(t, err)
+	configFile := `name: foo
+version: 1.0.0
+copyright:
+  upstream_name: foo
+  files:
+    - files: ["*"]
+      copyright: ["2017 Foo Bar <foo@bar.com>"]
+      license: MIT
+    - files: [debian/*]
+      copyright: ["2017 Foo Bar <foo@bar.com>"]
+      license: GPL-2+
+  licenses:
+    - license: MIT
+      text_file: ` + license + `
+`
+	filepath, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	require.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	assert.Nil(t, deb.Config(filepath))
+	require.NotNil(t, deb.copyright)
+	assert.Contains(t, deb.copyright.String(), "License: MIT\n Permission is hereby granted, free of charge.\n .\n THE SOFTWARE")
+	assert.Equal(t, "GPL-2+", deb.copyright.Files[1].License)
+
+	assert.Nil(t, testWrite(t, deb))
+
+	filepath, err = test.WriteTempFile(t.Name()+"-invalid.yml", "name: foo\ncopyright:\n  files:\n    - files: [\"*\"]\n      license: MIT\n")
+	require.Nil(t, err)
+	deb = New()
+	defer deb.Close()
+	var serr *SpecError
+	if assert.True(t, errors.As(deb.Config(filepath), &serr)) {
+		assert.Equal(t, "copyright", serr.Field)
+		assert.Equal(t, 2, serr.Line)
+	}
+}
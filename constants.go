@@ -31,6 +31,40 @@ const (
 	VcsTypeSubversion VcsType = "Svn"   // Subversion
 )
 
+// MultiArch for the Debian package multiarch behaviour
+type MultiArch string
+
+// Package MultiArch
+const (
+	MultiArchUnset   MultiArch = ""        // Multi-Arch field is skipped
+	MultiArchNo      MultiArch = "no"      // Not co-installable and dependencies must match the architecture (default)
+	MultiArchSame    MultiArch = "same"    // Co-installable with itself for other architectures, e.g. libraries
+	MultiArchForeign MultiArch = "foreign" // Satisfies dependencies of packages of other architectures, e.g. tools
+	MultiArchAllowed MultiArch = "allowed" // Allows dependencies with the :any qualifier
+)
+
+// PackageType for the Debian package flavour
+type PackageType string
+
+// Package PackageType
+const (
+	PackageTypeDeb  PackageType = "deb"  // Regular binary package (default)
+	PackageTypeUdeb PackageType = "udeb" // Micro binary package for the debian-installer, without md5sums
+	PackageTypeDdeb PackageType = "ddeb" // Automatic debug symbols (dbgsym) package
+)
+
+// Compression for the control and data archives of the Debian package
+type Compression string
+
+// Package Compression
+const (
+	CompressionNone  Compression = "none"  // Uncompressed control.tar and data.tar
+	CompressionGzip  Compression = "gzip"  // control.tar.gz and data.tar.gz (default)
+	CompressionXz    Compression = "xz"    // control.tar.xz and data.tar.xz
+	CompressionZstd  Compression = "zstd"  // control.tar.zst and data.tar.zst
+	CompressionBzip2 Compression = "bzip2" // data.tar.bz2 is only supported when reading packages
+)
+
 // Default installation variables
 const (
 	DefaultInstallPrefix = "/usr"  // Default install Prefix
@@ -43,3 +77,4 @@ const (
 const debianPathSeparator = "/"
 const debianBinaryVersion = "2.0\n"
 const debianFileExtension = "deb"
+const debianBuildIDDir = "usr/lib/debug/.build-id/"
@@ -21,10 +21,12 @@ type control struct {
 }
 
 type controlInfoVersion struct {
-	full  string // Full version string. E.g "0.1.2"
-	major uint   // Major version number
-	minor uint   // Minor version number
-	patch uint   // Patch version number
+	full     string // Full version string. E.g "0.1.2"
+	major    uint   // Major version number
+	minor    uint   // Minor version number
+	patch    uint   // Patch version number
+	epoch    uint   // Epoch, zero when omitted
+	revision string // Debian revision. E.g "1"
 }
 
 type controlInfo struct {
@@ -48,6 +50,27 @@ type controlInfo struct {
 	vcsURL          string  // E.g: git@github.com:xor-gate/debpkg.git
 	vcsBrowser      string  // E.g: https://github.com/xor-gate/debpkg
 	builtUsing      string  // E.g: gcc-4.6 (= 4.6.0-11)
+
+	preDepends         string        // E.g: "dpkg (>= 1.17.14)"
+	breaks             string        // E.g: "foo (<< 1.0)"
+	enhances           string        // E.g: "foo"
+	staticBuiltUsing   string        // E.g: "golang-1.22 (= 1.22.0-1)"
+	essential          bool          // Essential: yes
+	protected          bool          // Protected: yes
+	multiArch          MultiArch     // E.g: "same"
+	source             string        // E.g: "foo (1.2-1)"
+	originalMaintainer string        // E.g: "Foo Bar <foo@bar.com>"
+	rulesRequiresRoot  string        // E.g: "no"
+	bugs               string        // E.g: "debbugs://bugs.debian.org"
+	packageType        PackageType   // Flavour, empty for PackageTypeDeb
+	buildIDs           []string      // ELF build-ids of a ddeb, derived from the data when empty
+	customFields       []customField // User defined fields in order of first set
+}
+
+// customField is a user defined control field
+type customField struct {
+	name  string
+	value string
 }
 
 // SetName sets the name of the binary package (mandatory)
@@ -59,12 +82,24 @@ func (deb *DebPkg) SetName(name string) {
 // SetVersion sets the full version string (mandatory), or use SetVersion* functions for "major.minor.patch"
 // The upstream_version may contain only alphanumerics ( A-Za-z0-9 ) and the characters . + - : ~
 //  (full stop, plus, hyphen, colon, tilde) and should start with a digit.
-// NOTE: When the full string is set the other SetVersion* function calls are ignored
+// NOTE: When the full string is set the SetVersion{Major,Minor,Patch} function calls are ignored
 // See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Version
 func (deb *DebPkg) SetVersion(version string) {
 	deb.control.info.version.full = version
 }
 
+// SetVersionEpoch sets the version epoch, it overrides the epoch of the full version string. E.g: 1 for "1:2.30"
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Version
+func (deb *DebPkg) SetVersionEpoch(epoch uint) {
+	deb.control.info.version.epoch = epoch
+}
+
+// SetVersionRevision sets the debian revision, it overrides the revision of the full version string. E.g: "1" for "2.30-1"
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Version
+func (deb *DebPkg) SetVersionRevision(revision string) {
+	deb.control.info.version.revision = revision
+}
+
 // SetVersionMajor sets the version major number
 // See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Version
 func (deb *DebPkg) SetVersionMajor(major uint) {
@@ -84,9 +119,10 @@ func (deb *DebPkg) SetVersionPatch(patch uint) {
 }
 
 // SetArchitecture sets the architecture of the package where it can be installed.
-//  E.g "i386, amd64, arm, any, all". See `dpkg-architecture -L` for all supported.
-// Architecture: any
+//  E.g "i386, amd64, armhf, all". See `dpkg-architecture -L` for all supported.
+// Architecture: amd64 (or another CPU architecture)
 //    The generated binary package is an architecture dependent one usually in a compiled language.
+//    The "any" wildcard is only valid for source packages and rejected by Write.
 // Architecture: all
 //    The generated binary package is an architecture independent one usually consisting of text,
 //    images, or scripts in an interpreted language.
@@ -144,6 +180,152 @@ func (deb *DebPkg) SetReplaces(replaces string) {
 	deb.control.info.replaces = replaces
 }
 
+// SetPreDepends sets the packages which must be installed and configured before this one. E.g: "dpkg (>= 1.17.14)"
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#s-binarydeps
+func (deb *DebPkg) SetPreDepends(preDepends string) {
+	deb.control.info.preDepends = preDepends
+}
+
+// SetBreaks sets the packages which are broken by this one. E.g: "foo (<< 1.0)"
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#s-breaks
+func (deb *DebPkg) SetBreaks(breaks string) {
+	deb.control.info.breaks = breaks
+}
+
+// SetEnhances sets the packages which are enhanced by this one. E.g: "foo"
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#s-binarydeps
+func (deb *DebPkg) SetEnhances(enhances string) {
+	deb.control.info.enhances = enhances
+}
+
+// SetStaticBuiltUsing sets the source packages statically linked into this one. E.g: "golang-1.22 (= 1.22.0-1)"
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#s-built-using
+func (deb *DebPkg) SetStaticBuiltUsing(info string) {
+	deb.control.info.staticBuiltUsing = info
+}
+
+// SetEssential marks the package as essential, it can not be removed without --force-remove-essential
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-essential
+func (deb *DebPkg) SetEssential(essential bool) {
+	deb.control.info.essential = essential
+}
+
+// SetProtected marks the package as protected, it can not be removed without --force-remove-protected
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#protected
+func (deb *DebPkg) SetProtected(protected bool) {
+	deb.control.info.protected = protected
+}
+
+// SetMultiArch sets the multiarch behaviour. E.g: MultiArchSame for co-installable libraries
+// See: https://wiki.debian.org/Multiarch/Implementation
+func (deb *DebPkg) SetMultiArch(multiArch MultiArch) {
+	deb.control.info.multiArch = multiArch
+}
+
+// SetSource sets the source package name with an optional version when it differs. E.g: "foo (1.2-1)"
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-source
+func (deb *DebPkg) SetSource(source string) {
+	deb.control.info.source = source
+}
+
+// SetOriginalMaintainer sets the maintainer of the package this one is derived from. E.g: "Foo Bar <foo@bar.com>"
+func (deb *DebPkg) SetOriginalMaintainer(maintainer string) {
+	deb.control.info.originalMaintainer = maintainer
+}
+
+// SetRulesRequiresRoot sets if the package build requires root. E.g: "no", "binary-targets"
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-rules-requires-root
+func (deb *DebPkg) SetRulesRequiresRoot(rrr string) {
+	deb.control.info.rulesRequiresRoot = rrr
+}
+
+// SetBugs sets the bug tracking system URL. E.g: "debbugs://bugs.debian.org" or "https://github.com/foo/bar/issues"
+func (deb *DebPkg) SetBugs(url string) {
+	deb.control.info.bugs = url
+}
+
+// SetCustomField sets a user defined field, an empty value removes the field. The name must start with "X" and
+// optional S, B and C flags followed by a "-". As with dpkg-gencontrol the prefix is removed when the B flag
+// is present. E.g: "XB-Foo" is written as "Foo" and "X-Foo" is written as is.
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s5.7
+func (deb *DebPkg) SetCustomField(name, value string) error {
+	field, err := customFieldName(name)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(value, "\r") || strings.Contains(value, "\n\n") {
+		return fmt.Errorf("invalid value for custom field %s: must not contain empty lines", name)
+	}
+	value = strings.Replace(strings.TrimRight(value, "\n"), "\n", "\n ", -1)
+
+	fields := deb.control.info.customFields[:0]
+	found := false
+	for _, f := range deb.control.info.customFields {
+		if strings.EqualFold(f.name, field) {
+			found = true
+			if value == "" {
+				continue
+			}
+			f.value = value
+		}
+		fields = append(fields, f)
+	}
+	if !found && value != "" {
+		fields = append(fields, customField{name: field, value: value})
+	}
+	deb.control.info.customFields = fields
+	return nil
+}
+
+// customFieldName returns the field name written to the control file for a user defined field
+func customFieldName(name string) (string, error) {
+	i := strings.Index(name, "-")
+	if i < 1 || name[0] != 'X' || strings.Trim(name[1:i], "SBC") != "" || i == len(name)-1 {
+		return "", fmt.Errorf("invalid custom field name %q: must start with X-, XB-, XS- or XC-", name)
+	}
+	for _, r := range name {
+		if r <= ' ' || r > '~' || r == ':' {
+			return "", fmt.Errorf("invalid custom field name %q: must only contain printable ASCII without colons", name)
+		}
+	}
+	field := name
+	if strings.Contains(name[1:i], "B") {
+		field = name[i+1:]
+	}
+	if _, known := controlFieldNames[strings.ToLower(field)]; known {
+		return "", fmt.Errorf("invalid custom field name %q: %s is a known field", name, field)
+	}
+	return field, nil
+}
+
+// controlFieldNames are the fields written by the control file
+var controlFieldNames = map[string]bool{
+	"package": true, "source": true, "version": true, "architecture": true, "essential": true, "protected": true,
+	"bugs": true, "maintainer": true, "original-maintainer": true, "installed-size": true, "pre-depends": true,
+	"depends": true, "recommends": true, "suggests": true, "enhances": true, "conflicts": true, "breaks": true,
+	"replaces": true, "provides": true, "built-using": true, "static-built-using": true, "section": true,
+	"priority": true, "multi-arch": true, "homepage": true, "rules-requires-root": true, "vcs-browser": true,
+	"vcs-arch": true, "vcs-bzr": true, "vcs-darcs": true, "vcs-git": true, "vcs-hg": true, "vcs-mtn": true,
+	"vcs-svn": true, "description": true, "package-type": true, "auto-built-package": true, "build-ids": true,
+}
+
+// SetPackageType sets the package flavour (default PackageTypeDeb). A PackageTypeUdeb package has no md5sums
+// and a PackageTypeDdeb package is marked as automatically built debug symbols package.
+// The filename extension of GetFilename follows the flavour. E.g: "foo-1.0_amd64.udeb"
+// See: https://manpages.debian.org/deb-control#Package-Type
+func (deb *DebPkg) SetPackageType(packageType PackageType) {
+	if packageType == PackageTypeDeb {
+		packageType = ""
+	}
+	deb.control.info.packageType = packageType
+}
+
+// SetBuildIDs sets the ELF build-ids of the debug symbols in a PackageTypeDdeb package. When unset they are
+// derived from the files added below /usr/lib/debug/.build-id. E.g: "3a5e2b1c..."
+func (deb *DebPkg) SetBuildIDs(ids ...string) {
+	deb.control.info.buildIDs = ids
+}
+
 // SetPriority (recommended). Default set to debpkg.PriorityUnset
 // See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Priority
 // And: https://www.debian.org/doc/debian-policy/ch-archive.html#s-priorities
@@ -208,11 +390,14 @@ func (deb *DebPkg) SetBuiltUsing(info string) {
 // AddControlExtraString is the same as AddControlExtra except it uses a string input.
 // the files have possible DOS line-endings replaced by UNIX line-endings
 func (deb *DebPkg) AddControlExtraString(name, s string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
 	if name == "conffiles" {
 		deb.control.hasCustomConffiles = true
 	}
 	s = strings.Replace(s, "\r\n", "\n", -1)
-	return deb.control.tgz.AddFileFromBuffer(name, []byte(s), 0755)
+	return deb.control.tgz.AddFileFromBuffer(name, []byte(s), targzip.Attr{Mode: 0755})
 }
 
 // AddControlExtra allows the advanced user to add custom script to the control.tar.gz Typical usage is
@@ -227,17 +412,6 @@ func (deb *DebPkg) AddControlExtra(name, filename string) error {
 	return deb.AddControlExtraString(name, string(b))
 }
 
-// verify the control file for validity
-func (c *control) verify() error {
-	if c.info.name == "" {
-		return fmt.Errorf("empty package name")
-	}
-	if c.info.architecture == "" {
-		return fmt.Errorf("empty architecture")
-	}
-	return nil
-}
-
 func (c *control) markConfigFile(dest string) error {
 	if dest == "" {
 		return fmt.Errorf("config file cannot be empty")
@@ -246,91 +420,180 @@ func (c *control) markConfigFile(dest string) error {
 	return nil
 }
 
-// finalizeControlFile creates the actual control-file, adds MD5-sums and stores
+// finalizeControlFile creates the actual control-file, adds MD5-sums (and hash policy sums) and stores
 // config-files
 func (c *control) finalizeControlFile(d *data) error {
 	if !c.hasCustomConffiles {
-		if err := c.tgz.AddFileFromBuffer("conffiles", []byte(c.conffiles), 0); err != nil {
+		if err := c.tgz.AddFileFromBuffer("conffiles", []byte(c.conffiles), targzip.Attr{}); err != nil {
 			return err
 		}
 	}
+	if c.info.packageType == PackageTypeDdeb && len(c.info.buildIDs) == 0 {
+		c.info.buildIDs = d.buildIDs()
+	}
 	controlFile := []byte(c.String(d.tgz.Written()))
-	if err := c.tgz.AddFileFromBuffer("control", controlFile, 0); err != nil {
+	if err := c.tgz.AddFileFromBuffer("control", controlFile, targzip.Attr{}); err != nil {
 		return err
 	}
-	if err := c.tgz.AddFileFromBuffer("md5sums", []byte(d.md5sums), 0); err != nil {
+	if c.info.packageType == PackageTypeUdeb {
+		return nil
+	}
+	if err := c.tgz.AddFileFromBuffer("md5sums", []byte(d.md5sums), targzip.Attr{}); err != nil {
 		return err
 	}
+	if d.hash != 0 {
+		if err := c.tgz.AddFileFromBuffer(digestHashes[d.hash]+"sums", []byte(d.hashsums), targzip.Attr{}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Generate version string (e.g "1.2.3") from major,minor patch or from full version
+// Generate version string (e.g "1:1.2.3-1") from major,minor patch or from full version with the epoch and revision
 func (c *control) version() string {
-	if c.info.version.full != "" {
-		return c.info.version.full
+	upstream := c.info.version.full
+	if upstream == "" {
+		upstream = fmt.Sprintf("%d.%d.%d",
+			c.info.version.major,
+			c.info.version.minor,
+			c.info.version.patch)
+	}
+	if c.info.version.epoch == 0 && c.info.version.revision == "" {
+		return upstream
+	}
+
+	// An invalid full version is returned as-is and reported by validate
+	v, err := ParseVersion(upstream)
+	if err != nil {
+		return upstream
+	}
+	if c.info.version.epoch != 0 {
+		v.Epoch = c.info.version.epoch
 	}
-	return fmt.Sprintf("%d.%d.%d",
-		c.info.version.major,
-		c.info.version.minor,
-		c.info.version.patch)
+	if c.info.version.revision != "" {
+		v.Revision = c.info.version.revision
+	}
+	return v.String()
 }
 
 func (c *control) size() int64 {
 	return c.tgz.Size()
 }
 
-// Create control file for control.tar.gz
+// Create control file for control.tar.gz, the fields are in the canonical order of dpkg-gencontrol.
+// The Original-Maintainer, Rules-Requires-Root and Vcs-* fields precede the Description and custom fields follow it.
 func (c *control) String(installedSize uint64) string {
 	var o string
 
 	o += fmt.Sprintf("Package: %s\n", c.info.name)
+	if c.info.packageType != "" {
+		o += fmt.Sprintf("Package-Type: %s\n", c.info.packageType)
+	}
+	if c.info.source != "" {
+		o += fmt.Sprintf("Source: %s\n", c.info.source)
+	}
 	o += fmt.Sprintf("Version: %s\n", c.version())
+	if c.info.packageType == PackageTypeDdeb {
+		o += "Auto-Built-Package: debug-symbols\n"
+	}
 	o += fmt.Sprintf("Architecture: %s\n", c.info.architecture)
+	if c.info.essential {
+		o += "Essential: yes\n"
+	}
+	if c.info.protected {
+		o += "Protected: yes\n"
+	}
+	if c.info.bugs != "" {
+		o += fmt.Sprintf("Bugs: %s\n", c.info.bugs)
+	}
 	o += fmt.Sprintf("Maintainer: %s <%s>\n",
 		c.info.maintainer,
 		c.info.maintainerEmail)
+	if c.info.originalMaintainer != "" {
+		o += fmt.Sprintf("Original-Maintainer: %s\n", c.info.originalMaintainer)
+	}
 	o += fmt.Sprintf("Installed-Size: %d\n", uint64(math.Ceil(float64(installedSize)/1024)))
 
+	for _, rel := range []struct{ name, value string }{
+		{"Pre-Depends", c.info.preDepends},
+		{"Depends", c.info.depends},
+		{"Recommends", c.info.recommends},
+		{"Suggests", c.info.suggests},
+		{"Enhances", c.info.enhances},
+		{"Conflicts", c.info.conflicts},
+		{"Breaks", c.info.breaks},
+		{"Replaces", c.info.replaces},
+		{"Provides", c.info.provides},
+		{"Built-Using", c.info.builtUsing},
+		{"Static-Built-Using", c.info.staticBuiltUsing},
+	} {
+		if rel.value != "" {
+			o += fmt.Sprintf("%s: %s\n", rel.name, rel.value)
+		}
+	}
+
 	if c.info.section != "" {
 		o += fmt.Sprintf("Section: %s\n", c.info.section)
 	}
 	if c.info.priority != PriorityUnset {
 		o += fmt.Sprintf("Priority: %s\n", c.info.priority)
 	}
+	if c.info.multiArch != MultiArchUnset {
+		o += fmt.Sprintf("Multi-Arch: %s\n", c.info.multiArch)
+	}
 	if c.info.homepage != "" {
 		o += fmt.Sprintf("Homepage: %s\n", c.info.homepage)
 	}
+	if c.info.rulesRequiresRoot != "" {
+		o += fmt.Sprintf("Rules-Requires-Root: %s\n", c.info.rulesRequiresRoot)
+	}
 	if c.info.vcsType != VcsTypeUnset && c.info.vcsURL != "" {
 		o += fmt.Sprintf("Vcs-%s: %s\n", c.info.vcsType, c.info.vcsURL)
 	}
 	if c.info.vcsBrowser != "" {
 		o += fmt.Sprintf("Vcs-Browser: %s\n", c.info.vcsBrowser)
 	}
-	if c.info.builtUsing != "" {
-		o += fmt.Sprintf("Built-Using: %s\n", c.info.builtUsing)
-	}
 
-	if c.info.depends != "" {
-		o += fmt.Sprintf("Depends: %s\n", c.info.depends)
-	}
-	if c.info.recommends != "" {
-		o += fmt.Sprintf("Recommends: %s\n", c.info.recommends)
-	}
-	if c.info.suggests != "" {
-		o += fmt.Sprintf("Suggests: %s\n", c.info.suggests)
-	}
-	if c.info.conflicts != "" {
-		o += fmt.Sprintf("Conflicts: %s\n", c.info.conflicts)
+	o += fmt.Sprintf("Description: %s\n", c.info.descrShort)
+	o += fmt.Sprintf("%s", c.info.descr)
+
+	if (len(c.info.buildIDs) > 0 || len(c.info.customFields) > 0) && o[len(o)-1] != '\n' {
+		o += "\n"
 	}
-	if c.info.provides != "" {
-		o += fmt.Sprintf("Provides: %s\n", c.info.provides)
+	if len(c.info.buildIDs) > 0 {
+		o += fmt.Sprintf("Build-Ids: %s\n", strings.Join(c.info.buildIDs, " "))
 	}
-	if c.info.replaces != "" {
-		o += fmt.Sprintf("Replaces: %s\n", c.info.replaces)
+	for _, f := range c.info.customFields {
+		o += fmt.Sprintf("%s: %s\n", f.name, f.value)
 	}
 
-	o += fmt.Sprintf("Description: %s\n", c.info.descrShort)
-	o += fmt.Sprintf("%s", c.info.descr)
-
 	return o
 }
+
+// parseControlFields parses a control file as created by String into fields indexed by lowercase name.
+// Continuation lines are joined with a newline and keep their leading whitespace.
+func parseControlFields(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+	var last string
+
+	for n, line := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if last == "" {
+				return nil, fmt.Errorf("control line %d: continuation line without field", n+1)
+			}
+			fields[last] += "\n" + line
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("control line %d: missing field name", n+1)
+		}
+		last = strings.ToLower(line[:i])
+		fields[last] = strings.TrimSpace(line[i+1:])
+	}
+
+	return fields, nil
+}
@@ -174,6 +174,7 @@ func TestControlFileExtraString(t *testing.T) {
 	defer deb.Close()
 
 	deb.SetName("debpkg-control-file-extra-string")
+	testSetMaintainer(deb)
 	deb.SetArchitecture("all")
 	deb.SetDescription("bla bla\n")
 
@@ -206,6 +207,7 @@ echo "hello world from debpkg"
 	assert.Nil(t, err)
 
 	deb.SetName("debpkg-control-file-extra")
+	testSetMaintainer(deb)
 	deb.SetArchitecture("all")
 	deb.SetDescription("bla bla\n")
 
@@ -232,3 +234,90 @@ func TestConffiles(t *testing.T) {
 	deb.MarkConfigFile("bla/bla/foo")
 	assert.Equal(t, "bla/bla/foo\n", deb.control.conffiles)
 }
+
+// Test the canonical order of all control fields with custom fields after the description
+func TestControlFileAllFields(t *testing.T) {
+	controlExpect := `Package: libfoo1
+Source: foo (1.2-1)
+Version: 1.2-1
+Architecture: amd64
+Essential: yes
+Protected: yes
+Bugs: https://github.com/xor-gate/debpkg/issues
+Maintainer: Foo Bar <foo@bar.com>
+Original-Maintainer: Bar Foo <bar@foo.com>
+Installed-Size: 0
+Pre-Depends: dpkg (>= 1.17.14)
+Depends: libc6 (>= 2.31)
+Recommends: foo-doc
+Suggests: foo-utils
+Enhances: bar
+Conflicts: baz
+Breaks: libfoo0 (<< 1.0)
+Replaces: libfoo0 (<< 1.0)
+Provides: libfoo
+Built-Using: gcc-4.6 (= 4.6.0-11)
+Static-Built-Using: golang-1.22 (= 1.22.0-1)
+Section: libs
+Priority: optional
+Multi-Arch: same
+Homepage: https://github.com/xor-gate/debpkg
+Rules-Requires-Root: no
+Description: Foo library
+ Foo library for bar
+Foo-Build: 42
+X-Foo: multi
+ line
+`
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("libfoo1")
+	deb.SetSource("foo (1.2-1)")
+	deb.SetVersion("1.2-1")
+	deb.SetArchitecture("amd64")
+	deb.SetEssential(true)
+	deb.SetProtected(true)
+	deb.SetBugs("https://github.com/xor-gate/debpkg/issues")
+	deb.SetMaintainer("Foo Bar")
+	deb.SetMaintainerEmail("foo@bar.com")
+	deb.SetOriginalMaintainer("Bar Foo <bar@foo.com>")
+	deb.SetPreDepends("dpkg (>= 1.17.14)")
+	deb.SetDepends("libc6 (>= 2.31)")
+	deb.SetRecommends("foo-doc")
+	deb.SetSuggests("foo-utils")
+	deb.SetEnhances("bar")
+	deb.SetConflicts("baz")
+	assert.Nil(t, deb.AddBreaks("libfoo0", "<<", "1.0"))
+	deb.SetReplaces("libfoo0 (<< 1.0)")
+	deb.SetProvides("libfoo")
+	deb.SetBuiltUsing("gcc-4.6 (= 4.6.0-11)")
+	deb.SetStaticBuiltUsing("golang-1.22 (= 1.22.0-1)")
+	deb.SetSection("libs")
+	deb.SetPriority(PriorityOptional)
+	deb.SetMultiArch(MultiArchSame)
+	deb.SetHomepage("https://github.com/xor-gate/debpkg")
+	deb.SetRulesRequiresRoot("no")
+	deb.SetShortDescription("Foo library")
+	deb.SetDescription("Foo library for bar")
+	assert.Nil(t, deb.SetCustomField("XB-Foo-Build", "41"))
+	assert.Nil(t, deb.SetCustomField("X-Foo", "multi\nline\n"))
+	assert.Nil(t, deb.SetCustomField("XS-Removed", "yes"))
+	assert.Nil(t, deb.SetCustomField("XB-Foo-Build", "42"))
+	assert.Nil(t, deb.SetCustomField("XS-Removed", ""))
+
+	assert.Equal(t, controlExpect, deb.control.String(0))
+	assert.Empty(t, deb.Validate())
+	assert.Nil(t, testWrite(t, deb))
+}
+
+func TestSetCustomFieldError(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	for _, name := range []string{"Foo", "X", "X-", "XA-Foo", "X-Fo o", "X-Foo:", "XB-Depends", "XB-version"} {
+		assert.NotNil(t, deb.SetCustomField(name, "bar"), name)
+	}
+	assert.NotNil(t, deb.SetCustomField("X-Foo", "a\n\nb"))
+	assert.Empty(t, deb.control.info.customFields)
+}
@@ -0,0 +1,344 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CopyrightFormat is the Format field of a machine-readable copyright file
+const CopyrightFormat = "https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/"
+
+// copyrightLicenses are the known SPDX identifiers and DEP-5 short names in lower case, without the "+",
+// "-only" and "-or-later" suffixes
+var copyrightLicenses = map[string]bool{
+	"0bsd": true, "afl-3.0": true, "agpl-3.0": true, "apache": true, "apache-1.1": true, "apache-2.0": true,
+	"apsl-2.0": true, "artistic": true, "artistic-1.0": true, "artistic-2.0": true, "bsd-2-clause": true,
+	"bsd-3-clause": true, "bsd-4-clause": true, "bsl-1.0": true, "cc-by-3.0": true, "cc-by-4.0": true,
+	"cc-by-sa-3.0": true, "cc-by-sa-4.0": true, "cc0-1.0": true, "cddl-1.0": true, "cddl-1.1": true,
+	"cecill-2.1": true, "cpl-1.0": true, "epl-1.0": true, "epl-2.0": true, "eupl-1.2": true, "expat": true,
+	"ftl": true, "gfdl-1.2": true, "gfdl-1.3": true, "gfdl-niv": true, "gpl-1": true, "gpl-1.0": true,
+	"gpl-2": true, "gpl-2.0": true, "gpl-3": true, "gpl-3.0": true, "isc": true, "lgpl-2": true,
+	"lgpl-2.0": true, "lgpl-2.1": true, "lgpl-3": true, "lgpl-3.0": true, "lppl-1.3c": true, "mit": true,
+	"mit-0": true, "mpl-1.1": true, "mpl-2.0": true, "ms-pl": true, "ncsa": true, "ofl-1.1": true,
+	"openssl": true, "perl": true, "php-3.01": true, "postgresql": true, "psf-2.0": true, "public-domain": true,
+	"python-2.0": true, "ruby": true, "unlicense": true, "w3c": true, "wtfpl": true, "x11": true, "zlib": true,
+	"zope-2.1": true,
+}
+
+// copyrightCommonLicenses are the licenses of which the text is in /usr/share/common-licenses on every
+// Debian system, the copyright file does not need to include their text
+var copyrightCommonLicenses = map[string]bool{
+	"apache-2.0": true, "artistic": true, "artistic-1.0": true, "cc0-1.0": true, "gfdl-1.2": true,
+	"gfdl-1.3": true, "gpl-1": true, "gpl-1.0": true, "gpl-2": true, "gpl-2.0": true, "gpl-3": true,
+	"gpl-3.0": true, "lgpl-2": true, "lgpl-2.0": true, "lgpl-2.1": true, "lgpl-3": true, "lgpl-3.0": true,
+	"mpl-1.1": true, "mpl-2.0": true,
+}
+
+// copyrightLicenseSuffix matches the suffixes for later versions of a license. E.g: "GPL-2+" or "GPL-2.0-or-later"
+var copyrightLicenseSuffix = regexp.MustCompile(`(\+|-only|-or-later)$`)
+
+// Copyright is a machine-readable debian/copyright file (DEP-5). It is installed as
+// /usr/share/doc/<name>/copyright with SetCopyright.
+// See: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+type Copyright struct {
+	UpstreamName    string // Name upstream uses for the software. E.g: "foo"
+	UpstreamContact string // Preferred address to reach upstream. E.g: "Foo Bar <foo@bar.com>"
+	Source          string // Where the upstream source is from. E.g: "https://github.com/foo/foo"
+	Files           []CopyrightFiles
+	Licenses        []CopyrightLicense // Stand-alone license paragraphs
+}
+
+// CopyrightFiles is a Files paragraph, the last paragraph matching a file applies
+type CopyrightFiles struct {
+	Files       []string // Patterns relative to the source root. E.g: "*" or "debian/*"
+	Copyright   []string // Copyright holders. E.g: "2017 Foo Bar <foo@bar.com>"
+	License     string   // SPDX identifier or DEP-5 short name, may be an expression. E.g: "GPL-2+ or MIT"
+	LicenseText string   // License text (optional when a stand-alone license paragraph has it)
+	Comment     string
+}
+
+// CopyrightLicense is a stand-alone License paragraph with the license text
+type CopyrightLicense struct {
+	License string // SPDX identifier or DEP-5 short name. E.g: "MIT"
+	Text    string
+	Comment string
+}
+
+// AddFiles adds a Files paragraph of the patterns with the copyright holders and license
+func (c *Copyright) AddFiles(license string, copyright []string, files ...string) {
+	c.Files = append(c.Files, CopyrightFiles{Files: files, Copyright: copyright, License: license})
+}
+
+// AddLicense adds a stand-alone License paragraph with the text of the license
+func (c *Copyright) AddLicense(license, text string) {
+	c.Licenses = append(c.Licenses, CopyrightLicense{License: license, Text: text})
+}
+
+// ReadCopyright parses the debian/copyright file, problems are returned as *SpecError pointing to the paragraph
+func ReadCopyright(filename string) (*Copyright, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, &FileError{Op: "read copyright", Src: filename, Err: err}
+	}
+	defer f.Close()
+
+	c, err := ParseCopyright(f)
+	if serr, ok := err.(*SpecError); ok {
+		serr.File = filename
+	}
+	return c, err
+}
+
+// ParseCopyright parses a machine-readable copyright file, problems are returned as *SpecError pointing to
+// the first line of the paragraph
+func ParseCopyright(r io.Reader) (*Copyright, error) {
+	c := &Copyright{}
+	var paragraph []string
+	start, n, header := 0, 0, true
+
+	parse := func() error {
+		if len(paragraph) == 0 {
+			return nil
+		}
+		fields, err := parseControlFields(strings.Join(paragraph, "\n"))
+		paragraph = nil
+		if err != nil {
+			return &SpecError{Line: start, Err: err}
+		}
+
+		license, text := copyrightSplitLicense(fields["license"])
+		switch {
+		case header:
+			if fields["format"] == "" {
+				return &SpecError{Line: start, Field: "Format", Err: fmt.Errorf("missing header paragraph")}
+			}
+			header = false
+			c.UpstreamName = fields["upstream-name"]
+			c.UpstreamContact = strings.Join(copyrightLines(fields["upstream-contact"]), "\n")
+			c.Source = strings.Join(copyrightLines(fields["source"]), "\n")
+		case fields["files"] != "":
+			c.Files = append(c.Files, CopyrightFiles{
+				Files:       strings.Fields(fields["files"]),
+				Copyright:   copyrightLines(fields["copyright"]),
+				License:     license,
+				LicenseText: text,
+				Comment:     copyrightText(fields["comment"]),
+			})
+		case license != "":
+			c.Licenses = append(c.Licenses, CopyrightLicense{
+				License: license,
+				Text:    text,
+				Comment: copyrightText(fields["comment"]),
+			})
+		default:
+			return &SpecError{Line: start, Err: fmt.Errorf("paragraph is neither a Files nor a License paragraph")}
+		}
+		return nil
+	}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		n++
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if line == "" {
+			if err := parse(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(paragraph) == 0 {
+			start = n
+		}
+		paragraph = append(paragraph, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := parse(); err != nil {
+		return nil, err
+	}
+	if header {
+		return nil, &SpecError{Field: "Format", Err: fmt.Errorf("missing header paragraph")}
+	}
+	return c, nil
+}
+
+// Validate checks every Files paragraph has patterns, copyright holders and known licenses. The text of
+// licenses outside /usr/share/common-licenses must be included, custom licenses use the "LicenseRef-" prefix.
+func (c *Copyright) Validate() error {
+	if len(c.Files) == 0 {
+		return &ValidationError{Field: "Copyright", Err: fmt.Errorf("no Files paragraphs")}
+	}
+
+	texts := make(map[string]bool)
+	for _, l := range c.Licenses {
+		if strings.TrimSpace(l.License) == "" {
+			return &ValidationError{Field: "Copyright", Err: fmt.Errorf("stand-alone license paragraph without name")}
+		}
+		if strings.TrimSpace(l.Text) != "" {
+			texts[copyrightNormalizeLicense(l.License)] = true
+		}
+	}
+
+	for _, f := range c.Files {
+		if len(f.Files) == 0 {
+			return &ValidationError{Field: "Copyright", Err: fmt.Errorf("files paragraph of %s without patterns", f.License)}
+		}
+		if len(f.Copyright) == 0 {
+			return &ValidationError{Field: "Copyright", Err: fmt.Errorf("missing copyright of %s",
+				strings.Join(f.Files, " "))}
+		}
+		licenses, err := copyrightLicenseIdentifiers(f.License)
+		if err != nil {
+			return &ValidationError{Field: "Copyright", Err: fmt.Errorf("invalid license of %s: %w",
+				strings.Join(f.Files, " "), err)}
+		}
+		for _, license := range licenses {
+			name := copyrightNormalizeLicense(license)
+			if !copyrightLicenses[name] && !strings.HasPrefix(license, "LicenseRef-") {
+				return &ValidationError{Field: "Copyright", Err: fmt.Errorf("unknown license %q of %s",
+					license, strings.Join(f.Files, " "))}
+			}
+			inline := len(licenses) == 1 && strings.TrimSpace(f.LicenseText) != ""
+			if !copyrightCommonLicenses[name] && !texts[name] && !inline {
+				return &ValidationError{Field: "Copyright", Err: fmt.Errorf("missing text of license %q of %s",
+					license, strings.Join(f.Files, " "))}
+			}
+		}
+	}
+	return nil
+}
+
+// String returns the copyright file in the machine-readable format
+func (c *Copyright) String() string {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value == "" {
+			return
+		}
+		lines := strings.Split(value, "\n")
+		fmt.Fprintf(&b, "%s: %s\n", name, lines[0])
+		for _, line := range lines[1:] {
+			if strings.TrimSpace(line) == "" {
+				line = "."
+			}
+			fmt.Fprintf(&b, " %s\n", line)
+		}
+	}
+	license := func(name, text string) string {
+		if text = strings.Trim(text, "\n"); text != "" {
+			return name + "\n" + text
+		}
+		return name
+	}
+
+	field("Format", CopyrightFormat)
+	field("Upstream-Name", c.UpstreamName)
+	field("Upstream-Contact", c.UpstreamContact)
+	field("Source", c.Source)
+	for _, f := range c.Files {
+		b.WriteString("\n")
+		field("Files", strings.Join(f.Files, " "))
+		field("Copyright", strings.Join(f.Copyright, "\n"))
+		field("License", license(f.License, f.LicenseText))
+		field("Comment", f.Comment)
+	}
+	for _, l := range c.Licenses {
+		b.WriteString("\n")
+		field("License", license(l.License, l.Text))
+		field("Comment", l.Comment)
+	}
+	return b.String()
+}
+
+// SetCopyright sets the machine-readable copyright which is installed as /usr/share/doc/<name>/copyright on write
+func (deb *DebPkg) SetCopyright(c *Copyright) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	deb.copyright = c
+	return nil
+}
+
+// addCopyright adds the copyright file to the data archive
+func (deb *DebPkg) addCopyright() error {
+	if deb.copyright == nil {
+		return nil
+	}
+	dest := "/usr/share/doc/" + deb.control.info.name + "/copyright"
+	return fileError("add file", "", dest, deb.data.addFileString(deb.copyright.String(), dest))
+}
+
+// copyrightLicenseIdentifiers returns the licenses of the expression. E.g: "GPL-2+ with OpenSSL exception or MIT"
+// or "(MIT OR Apache-2.0) AND BSD-3-Clause"
+func copyrightLicenseIdentifiers(expression string) ([]string, error) {
+	var licenses []string
+	tokens := strings.Fields(strings.NewReplacer("(", " ", ")", " ", ",", " ").Replace(expression))
+	for i := 0; i < len(tokens); i++ {
+		switch strings.ToLower(tokens[i]) {
+		case "or", "and":
+		case "with":
+			// Skip the exception. E.g: "with OpenSSL exception" or "WITH Classpath-exception-2.0"
+			if i++; i+1 < len(tokens) && strings.ToLower(tokens[i+1]) == "exception" {
+				i++
+			}
+		default:
+			licenses = append(licenses, tokens[i])
+		}
+	}
+	if len(licenses) == 0 {
+		return nil, fmt.Errorf("empty license %q", expression)
+	}
+	return licenses, nil
+}
+
+// copyrightNormalizeLicense returns the license in lower case without the suffix for later versions
+func copyrightNormalizeLicense(license string) string {
+	return strings.ToLower(copyrightLicenseSuffix.ReplaceAllString(license, ""))
+}
+
+// copyrightSplitLicense splits a License field in the license name of the first line and the text
+func copyrightSplitLicense(value string) (license, text string) {
+	lines := strings.SplitN(value, "\n", 2)
+	if len(lines) == 1 {
+		return strings.TrimSpace(lines[0]), ""
+	}
+	return strings.TrimSpace(lines[0]), copyrightText(lines[1])
+}
+
+// copyrightText returns the text of a field value, the leading space of every line is removed and a "." line
+// is an empty line
+func copyrightText(value string) string {
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		line = strings.TrimPrefix(strings.TrimPrefix(line, " "), "\t")
+		if line == "." {
+			line = ""
+		}
+		lines[i] = line
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// copyrightLines returns the trimmed lines of a field value without the empty lines
+func copyrightLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line != "." {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
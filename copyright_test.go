@@ -0,0 +1,166 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+const testCopyright = `Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/
+Upstream-Name: foo
+Upstream-Contact: Foo Bar <foo@bar.com>
+Source: https://github.com/foo/foo
+
+Files: *
+Copyright: 2017 Foo Bar <foo@bar.com>
+ 2018 Bar Baz <bar@baz.com>
+License: MIT
+
+Files: debian/* vendor/bar/*
+Copyright: 2017 Foo Bar <foo@bar.com>
+License: GPL-2+ with OpenSSL exception or Apache-2.0
+Comment: Packaging is dual licensed.
+
+Files: vendor/baz/*
+Copyright: 2016 Baz
+License: LicenseRef-Baz
+ Baz may be used for anything.
+ .
+   Really anything.
+
+License: MIT
+ Permission is hereby granted, free of charge, to any person obtaining a copy
+ of this software and associated documentation files.
+ .
+ THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND.
+`
+
+func TestParseCopyright(t *testing.T) {
+	c, err := ParseCopyright(strings.NewReader(testCopyright))
+	require.Nil(t, err)
+
+	assert.Equal(t, "foo", c.UpstreamName)
+	assert.Equal(t, "Foo Bar <foo@bar.com>", c.UpstreamContact)
+	assert.Equal(t, "https://github.com/foo/foo", c.Source)
+	require.Len(t, c.Files, 3)
+	assert.Equal(t, []string{"*"}, c.Files[0].Files)
+	assert.Equal(t, []string{"2017 Foo Bar <foo@bar.com>", "2018 Bar Baz <bar@baz.com>"}, c.Files[0].Copyright)
+	assert.Equal(t, "MIT", c.Files[0].License)
+	assert.Equal(t, []string{"debian/*", "vendor/bar/*"}, c.Files[1].Files)
+	assert.Equal(t, "GPL-2+ with OpenSSL exception or Apache-2.0", c.Files[1].License)
+	assert.Equal(t, "Packaging is dual licensed.", c.Files[1].Comment)
+	assert.Equal(t, "LicenseRef-Baz", c.Files[2].License)
+	assert.Equal(t, "Baz may be used for anything.\n\n  Really anything.", c.Files[2].LicenseText)
+	require.Len(t, c.Licenses, 1)
+	assert.Equal(t, "MIT", c.Licenses[0].License)
+	assert.True(t, strings.HasSuffix(c.Licenses[0].Text, "files.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND."))
+
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, testCopyright, c.String())
+}
+
+func TestParseCopyrightError(t *testing.T) {
+	for _, tc := range []struct {
+		copyright string
+		line      int
+	}{
+		{"", 0},
+		{"Upstream-Name: foo\n", 1},
+		{"Format: " + CopyrightFormat + "\n\nComment: foo\n", 3},
+		{"Format: " + CopyrightFormat + "\n\nFiles: *\nno field\n", 3},
+	} {
+		_, err := ParseCopyright(strings.NewReader(tc.copyright))
+		var serr *SpecError
+		if assert.True(t, errors.As(err, &serr), tc.copyright) {
+			assert.Equal(t, tc.line, serr.Line, tc.copyright)
+		}
+	}
+
+	_, err := ReadCopyright("/non/existent/copyright")
+	var ferr *FileError
+	assert.True(t, errors.As(err, &ferr))
+}
+
+func TestCopyrightValidate(t *testing.T) {
+	holders := []string{"2017 Foo Bar <foo@bar.com>"}
+	for _, tc := range []struct {
+		build func(c *Copyright)
+		valid bool
+	}{
+		{func(c *Copyright) {}, false},
+		{func(c *Copyright) { c.AddFiles("GPL-2+", holders, "*") }, true},
+		{func(c *Copyright) { c.AddFiles("GPL-3.0-or-later WITH Classpath-exception-2.0", holders, "*") }, true},
+		{func(c *Copyright) { c.AddFiles("(Apache-2.0 OR MPL-2.0) AND LGPL-2.1", holders, "*") }, true},
+		{func(c *Copyright) { c.AddFiles("MIT", holders, "*") }, false},
+		{func(c *Copyright) {
+			c.AddFiles("MIT", holders, "*")
+			c.AddLicense("MIT", "Permission is hereby granted")
+		}, true},
+		{func(c *Copyright) { c.AddFiles("GPL-2 or MIT", holders, "*"); c.AddLicense("Expat", "Permission") }, false},
+		{func(c *Copyright) { c.AddFiles("Foo-1.0", holders, "*"); c.AddLicense("Foo-1.0", "Foo") }, false},
+		{func(c *Copyright) { c.AddFiles("LicenseRef-Foo", holders, "*"); c.AddLicense("LicenseRef-Foo", "Foo") }, true},
+		{func(c *Copyright) { c.AddFiles("GPL-2", nil, "*") }, false},
+		{func(c *Copyright) { c.AddFiles("GPL-2", holders) }, false},
+		{func(c *Copyright) { c.AddFiles("", holders, "*") }, false},
+		{func(c *Copyright) { c.AddFiles("GPL-2", holders, "*"); c.AddLicense("", "text") }, false},
+	} {
+		c := &Copyright{}
+		tc.build(c)
+		err := c.Validate()
+		if tc.valid {
+			assert.Nil(t, err, c.String())
+			continue
+		}
+		var verr *ValidationError
+		if assert.True(t, errors.As(err, &verr), c.String()) {
+			assert.Equal(t, "Copyright", verr.Field)
+		}
+	}
+}
+
+func TestSetCopyright(t *testing.T) {
+	c := &Copyright{UpstreamName: "foo"}
+	c.AddFiles("MIT", []string{"2017 Foo Bar <foo@bar.com>"}, "*")
+
+	deb := New()
+	defer deb.Close()
+	deb.SetName("foo")
+	deb.SetVersion("1.0.0")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+	assert.NotNil(t, deb.SetCopyright(c))
+	c.AddLicense("MIT", "Permission is hereby granted, free of charge.")
+	require.Nil(t, deb.SetCopyright(c))
+
+	filename := filepath.Join(test.TempDir(), "copyright-"+deb.GetFilename())
+	require.Nil(t, deb.Write(filename))
+	assert.Equal(t, ErrWritten, deb.SetCopyright(c))
+
+	r, err := Open(filename)
+	require.Nil(t, err)
+	defer r.Close()
+	it, err := r.Data()
+	require.Nil(t, err)
+	defer it.Close()
+	for {
+		hdr, err := it.Next()
+		require.Nil(t, err)
+		if strings.HasSuffix(hdr.Name, "usr/share/doc/foo/copyright") {
+			assert.Equal(t, int64(0644), hdr.Mode)
+			break
+		}
+	}
+	b, err := ioutil.ReadAll(it)
+	require.Nil(t, err)
+	assert.Equal(t, c.String(), string(b))
+}
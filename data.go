@@ -6,23 +6,100 @@ package debpkg
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/xor-gate/debpkg/internal/targzip"
 )
 
 type data struct {
-	md5sums string
-	tgz     *targzip.TarGzip
-	dirs    []string
+	md5sums  string
+	hashsums string      // Checksums in md5sums format for the hash policy. E.g: sha256sums
+	hash     crypto.Hash // Hash policy for hashsums (zero when disabled)
+	tgz      *targzip.TarGzip
+	dirs     []string
+	sorted   bool              // When set entries are written sorted by name on flush
+	entries  []dataEntry       // Entries pending for flush when sorted
+	links    map[string]string // Hardlink destinations to the file they link to
+}
+
+// dataEntry is a single archive entry which is written on flush
+type dataEntry struct {
+	name  string
+	link  bool // Hardlinks are written after all other entries so their target exists
+	write func() error
+}
+
+// empty reports whether nothing has been added to the archive
+func (d *data) empty() bool {
+	return len(d.entries) == 0 && len(d.dirs) == 0 && d.md5sums == "" && (d.tgz == nil || !d.tgz.Started())
+}
+
+// write writes an archive entry directly, or defers it until flush when sorted
+func (d *data) write(name string, fn func() error) error {
+	if !d.sorted {
+		return fn()
+	}
+	d.entries = append(d.entries, dataEntry{name: strings.Trim(name, "/"), write: fn})
+	return nil
+}
+
+// writeLink writes a hardlink entry directly, or defers it until flush when sorted
+func (d *data) writeLink(name string, fn func() error) error {
+	if !d.sorted {
+		return fn()
+	}
+	d.entries = append(d.entries, dataEntry{name: strings.Trim(name, "/"), link: true, write: fn})
+	return nil
+}
+
+// flush writes all pending entries sorted by name with the hardlinks last and sorts the md5sums
+func (d *data) flush() error {
+	if !d.sorted {
+		return nil
+	}
+	sort.SliceStable(d.entries, func(i, j int) bool {
+		if d.entries[i].link != d.entries[j].link {
+			return d.entries[j].link
+		}
+		return d.entries[i].name < d.entries[j].name
+	})
+	for _, e := range d.entries {
+		if err := e.write(); err != nil {
+			return err
+		}
+	}
+	d.entries = nil
+	d.md5sums = sortSums(d.md5sums)
+	d.hashsums = sortSums(d.hashsums)
+	return nil
+}
+
+// sortSums sorts the lines "<sum>  <path>\n" of a md5sums-like file by path
+func sortSums(sums string) string {
+	// The trailing empty element is dropped as every line ends with a newline
+	lines := strings.SplitAfter(sums, "\n")
+	lines = lines[:len(lines)-1]
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][strings.Index(lines[i], "  "):] < lines[j][strings.Index(lines[j], "  "):]
+	})
+	return strings.Join(lines, "")
 }
 
 func (d *data) addDirectory(dirpath string) error {
+	return d.addDirectoryAttr(dirpath, targzip.Attr{})
+}
+
+// addDirectoryAttr adds a directory with mode and ownership, which must be added before its contents
+func (d *data) addDirectoryAttr(dirpath string, attr targzip.Attr) error {
 	dirpath = filepath.Clean(dirpath)
 	if os.PathSeparator != '/' {
 		dirpath = strings.Replace(dirpath, string(os.PathSeparator), "/", -1)
@@ -30,6 +107,9 @@ func (d *data) addDirectory(dirpath string) error {
 	d.addParentDirectories(dirpath)
 	for _, addedDir := range d.dirs {
 		if addedDir == dirpath {
+			if attr != (targzip.Attr{}) {
+				return fmt.Errorf("directory %s is already added", dirpath)
+			}
 			return nil
 		}
 	}
@@ -37,7 +117,9 @@ func (d *data) addDirectory(dirpath string) error {
 		return nil
 	}
 
-	if err := d.tgz.AddDirectory(dirpath); err != nil {
+	if err := d.write(dirpath, func() error {
+		return d.tgz.AddDirectory(dirpath, attr)
+	}); err != nil {
 		return err
 	}
 	d.dirs = append(d.dirs, dirpath)
@@ -62,24 +144,33 @@ func (d *data) addParentDirectories(filename string) {
 	}
 }
 
-func (d *data) addToMD5sums(md5 []byte, dest string) {
+func (d *data) addToSums(md5, hashsum []byte, dest string) {
 	dest = strings.TrimPrefix(dest, "/")
 	d.md5sums += fmt.Sprintf("%x  %s\n", md5, dest)
+	if hashsum != nil {
+		d.hashsums += fmt.Sprintf("%x  %s\n", hashsum, dest)
+	}
 }
 
 func (d *data) addFileString(contents, dest string) error {
+	return d.addFileStringAttr(contents, dest, targzip.Attr{})
+}
+
+func (d *data) addFileStringAttr(contents, dest string, attr targzip.Attr) error {
 	d.addParentDirectories(dest)
 
-	if err := d.tgz.AddFileFromBuffer(dest, []byte(contents), 0); err != nil {
+	if err := d.write(dest, func() error {
+		return d.tgz.AddFileFromBuffer(dest, []byte(contents), attr)
+	}); err != nil {
 		return err
 	}
 
-	md5, err := computeMd5(bytes.NewBufferString(contents))
+	md5, hashsum, err := d.computeSums(bytes.NewBufferString(contents))
 	if err != nil {
 		return err
 	}
 
-	d.addToMD5sums(md5, dest)
+	d.addToSums(md5, hashsum, dest)
 	return nil
 }
 
@@ -88,14 +179,21 @@ func (d *data) addFile(filename string, dest ...string) error {
 
 	if len(dest) > 0 && len(dest[0]) > 0 {
 		destfilename = dest[0]
-	} else {
+	}
+	return d.addFileAttr(filename, destfilename, targzip.Attr{})
+}
+
+// addFileAttr adds a file with mode and ownership to dest (filename when empty)
+func (d *data) addFileAttr(filename, destfilename string, attr targzip.Attr) error {
+	if destfilename == "" {
 		destfilename = filename
 	}
 
 	d.addParentDirectories(destfilename)
 
-	//
-	if err := d.tgz.AddFile(filename, dest...); err != nil {
+	if err := d.write(destfilename, func() error {
+		return d.tgz.AddFile(filename, destfilename, attr)
+	}); err != nil {
 		return err
 	}
 
@@ -104,24 +202,106 @@ func (d *data) addFile(filename string, dest ...string) error {
 		return err
 	}
 
-	md5, err := computeMd5(fd)
+	md5, hashsum, err := d.computeSums(fd)
 	if err != nil {
 		fd.Close()
 		return err
 	}
 
-	d.addToMD5sums(md5, destfilename)
+	d.addToSums(md5, hashsum, destfilename)
 
 	fd.Close()
 	return nil
 }
 
-// computeMd5 from the os filedescriptor
-func computeMd5(fd io.Reader) (data []byte, err error) {
-	var result []byte
-	hash := md5.New()
-	if _, err := io.Copy(hash, fd); err != nil {
-		return result, err
+// addSymlink adds a symbolic link, symlinks are not part of the md5sums
+func (d *data) addSymlink(target, dest string) error {
+	if dest == "" {
+		return fmt.Errorf("empty symlink destination")
+	}
+	d.addParentDirectories(dest)
+	return d.write(dest, func() error {
+		return d.tgz.AddSymlink(target, dest)
+	})
+}
+
+// addHardlink adds a hard link to an already added file, the md5sums entry of the target is reused.
+// A link to a hardlink links to the file of that hardlink, so every link target is a regular file.
+func (d *data) addHardlink(target, dest string) error {
+	if dest == "" {
+		return fmt.Errorf("empty hardlink destination")
+	}
+	md5, hashsum := d.lookupSums(target)
+	if md5 == nil {
+		return fmt.Errorf("hardlink target %s is not added", target)
+	}
+	if file, ok := d.links[strings.Trim(target, "/")]; ok {
+		target = file
+	}
+	d.addParentDirectories(dest)
+	if err := d.writeLink(dest, func() error {
+		return d.tgz.AddHardlink(target, dest)
+	}); err != nil {
+		return err
+	}
+	if d.links == nil {
+		d.links = make(map[string]string)
+	}
+	d.links[strings.Trim(dest, "/")] = target
+	d.addToSums(md5, hashsum, dest)
+	return nil
+}
+
+// lookupSums finds the md5 and hash policy sum of an added file (nil when not found)
+func (d *data) lookupSums(dest string) (md5sum, hashsum []byte) {
+	dest = strings.TrimPrefix(dest, "/")
+	find := func(sums string) []byte {
+		for _, line := range strings.Split(sums, "\n") {
+			if i := strings.Index(line, "  "); i > 0 && line[i+2:] == dest {
+				sum, _ := hex.DecodeString(line[:i])
+				return sum
+			}
+		}
+		return nil
+	}
+	return find(d.md5sums), find(d.hashsums)
+}
+
+// buildIDs returns the sorted ELF build-ids of the added debug files. E.g: "usr/lib/debug/.build-id/3a/5e2b.debug"
+func (d *data) buildIDs() []string {
+	var ids []string
+	for _, line := range strings.Split(d.md5sums, "\n") {
+		i := strings.Index(line, "  ")
+		if i < 0 || !strings.HasPrefix(line[i+2:], debianBuildIDDir) {
+			continue
+		}
+		name := strings.TrimPrefix(line[i+2:], debianBuildIDDir)
+		if len(name) < 3 || name[2] != '/' || !strings.HasSuffix(name, ".debug") {
+			continue
+		}
+		id := name[:2] + strings.TrimSuffix(name[3:], ".debug")
+		if _, err := hex.DecodeString(id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// computeSums computes the md5 and the hash policy sum (nil when disabled) from the os filedescriptor
+func (d *data) computeSums(fd io.Reader) (md5sum, hashsum []byte, err error) {
+	md5hash := md5.New()
+	w := io.Writer(md5hash)
+	var h hash.Hash
+	if d.hash != 0 {
+		h = d.hash.New()
+		w = io.MultiWriter(md5hash, h)
+	}
+	if _, err := io.Copy(w, fd); err != nil {
+		return nil, nil, err
+	}
+	if h != nil {
+		hashsum = h.Sum(nil)
 	}
-	return hash.Sum(result), nil
+	return md5hash.Sum(nil), hashsum, nil
 }
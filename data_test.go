@@ -80,3 +80,36 @@ func TestDataAddFileError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Empty(t, d.md5sums)
 }
+
+func TestDataAddSymlink(t *testing.T) {
+	d := newData(t)
+	assert.Nil(t, d.addSymlink("/opt/foo/bin/foo", "/usr/bin/foo"))
+	assert.Equal(t, []string{"/usr", "/usr/bin"}, d.dirs)
+	assert.Empty(t, d.md5sums)
+	assert.NotNil(t, d.addSymlink("", "/usr/bin/bar"))
+	assert.NotNil(t, d.addSymlink("/opt/foo/bin/bar", ""))
+
+	assert.Nil(t, d.tgz.Close())
+	os.Remove(d.tgz.Name())
+}
+
+func TestDataAddHardlink(t *testing.T) {
+	d := newData(t)
+	assert.NotNil(t, d.addHardlink("/foo", "/bar"))
+	assert.Nil(t, d.addFileString("test", "/foo"))
+	assert.Nil(t, d.addHardlink("/foo", "/bar"))
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6  foo\n098f6bcd4621d373cade4e832627b4f6  bar\n", d.md5sums)
+
+	assert.Nil(t, d.tgz.Close())
+	os.Remove(d.tgz.Name())
+}
+
+func TestDataAddDirectoryAttr(t *testing.T) {
+	d := newData(t)
+	assert.Nil(t, d.addDirectoryAttr("/var/lib/foo", targzip.Attr{Mode: 0700}))
+	assert.NotNil(t, d.addDirectoryAttr("/var/lib", targzip.Attr{Mode: 0700}))
+	assert.Nil(t, d.addDirectory("/var/lib"))
+
+	assert.Nil(t, d.tgz.Close())
+	os.Remove(d.tgz.Name())
+}
@@ -5,174 +5,473 @@
 package debpkg
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"runtime"
+	"strconv"
+	"text/template"
+	"time"
 
 	"github.com/xor-gate/debpkg/internal/targzip"
 )
 
 // DebPkg holds data for a single debian package
 type DebPkg struct {
-	debianBinary string
-	control      control
-	data         data
-	digest       digest
-	err          error
+	debianBinary     string
+	control          control
+	data             data
+	digest           digest
+	buildTime        time.Time          // Fixed timestamp for reproducible builds (zero when unset)
+	epochBuildTime   bool               // Set when the build time defaults to the unix epoch by SetReproducible
+	filenameTemplate *template.Template // Template for Filename (nil for GetFilename)
+	observer         Observer           // Receives the build progress events (nil when unset)
+	changelog        *Changelog         // Installed as changelog.Debian.gz (nil when unset)
+	copyright        *Copyright         // Installed as copyright (nil when unset)
+	ctx              context.Context    // Context of the running operation for cancellation (nil when none)
+	newArchive       archiveFunc        // Creates the intermediate archives, reused by Reset
+	written          bool               // Set when the archives are finalized by the first write
+	err              error
+}
+
+// archiveFunc creates an empty intermediate archive
+type archiveFunc func() (*targzip.TarGzip, error)
+
+// FileAttributes overrides the mode and ownership of a file or directory, zero values keep the defaults.
+// Added files keep their host permissions, files from strings default to 0644 and directories to 0755.
+// The owner and group default to root.
+type FileAttributes struct {
+	Mode  os.FileMode // Permissions including os.ModeSetuid, os.ModeSetgid and os.ModeSticky. E.g: 0755
+	Uid   int         // Owner user id
+	Gid   int         // Owner group id
+	Owner string      // Owner user name. E.g: "root"
+	Group string      // Owner group name. E.g: "adm"
+}
+
+// attr converts the attributes to the tar mode and ownership
+func (a FileAttributes) attr() targzip.Attr {
+	mode := int64(a.Mode.Perm())
+	if a.Mode&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if a.Mode&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if a.Mode&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return targzip.Attr{
+		Mode:  mode,
+		Uid:   a.Uid,
+		Gid:   a.Gid,
+		Uname: a.Owner,
+		Gname: a.Group,
+	}
 }
 
 // New creates new debian package, optionally provide an tempdir to write
 //  intermediate files, otherwise os.TempDir is used. A provided tempdir must exist
 //  in order for it to work.
 func New(tempDir ...string) *DebPkg {
-	deb := &DebPkg{
-		debianBinary: debianBinaryVersion,
-	}
-
 	dir := os.TempDir()
 	if len(tempDir) > 0 && len(tempDir[0]) > 0 {
 		dir = tempDir[0]
 	}
+	return newDebPkg(func() (*targzip.TarGzip, error) {
+		return targzip.NewTempFile(dir)
+	})
+}
+
+// NewInMemory creates new debian package which keeps the intermediate control and data archives
+// in memory, no temporary files are created. Use it with WriteTo to stream a package without tempdir.
+func NewInMemory() *DebPkg {
+	return newDebPkg(func() (*targzip.TarGzip, error) {
+		return targzip.NewMemory(), nil
+	})
+}
+
+// newDebPkg creates the package with the control and data archives from newArchive
+func newDebPkg(newArchive archiveFunc) *DebPkg {
+	deb := &DebPkg{}
+	deb.init(newArchive)
+	return deb
+}
+
+// init prepares the empty package with the control and data archives from newArchive
+func (deb *DebPkg) init(newArchive archiveFunc) {
+	deb.debianBinary = debianBinaryVersion
+	deb.newArchive = newArchive
+	deb.SetHash(digestDefaultHash)
+
+	var buildTime time.Time
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			deb.setError(fmt.Errorf("invalid SOURCE_DATE_EPOCH: %q", epoch))
+			return
+		}
+		buildTime = time.Unix(sec, 0)
+	}
 
-	control, err := targzip.NewTempFile(dir)
+	control, err := newArchive()
 	if err != nil {
-		deb.setError(ErrIO)
-		return deb
+		deb.setError(fileError("create archive", "", "control", err))
+		return
 	}
 
-	data, err := targzip.NewTempFile(dir)
+	data, err := newArchive()
 	if err != nil {
-		control.Close()
 		control.Remove()
-		deb.setError(ErrIO)
-		return deb
+		deb.setError(fileError("create archive", "", "data", err))
+		return
 	}
 
 	deb.control.tgz = control
 	deb.data.tgz = data
+	deb.control.tgz.SetProgress(deb.stageProgress(StageControl))
+	deb.data.tgz.SetProgress(deb.stageProgress(StageData))
 
-	return deb
+	if !buildTime.IsZero() {
+		if err := deb.SetReproducible(true); err != nil {
+			deb.setError(err)
+			return
+		}
+		if err := deb.SetBuildTime(buildTime); err != nil {
+			deb.setError(err)
+			return
+		}
+	}
+}
+
+// SetBuildTime sets a fixed timestamp for all archive members, added file modification times
+// are clamped to it. It is automatically set from the SOURCE_DATE_EPOCH environment variable.
+// See: https://reproducible-builds.org/specs/source-date-epoch/
+func (deb *DebPkg) SetBuildTime(t time.Time) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	deb.buildTime = t.UTC()
+	deb.epochBuildTime = false
+	if deb.control.tgz != nil && deb.data.tgz != nil {
+		deb.control.tgz.SetModTime(deb.buildTime)
+		deb.data.tgz.SetModTime(deb.buildTime)
+	}
+	return nil
+}
+
+// SetReproducible enables reproducible builds, data entries and md5sums are sorted by name and
+// timestamps are fixed to the build time (defaults to the unix epoch when SetBuildTime is not called).
+// It must be called before any file is added to the package.
+func (deb *DebPkg) SetReproducible(enable bool) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if !deb.data.empty() {
+		return fmt.Errorf("cannot change reproducible builds after files are added")
+	}
+	deb.data.sorted = enable
+	switch {
+	case enable && deb.buildTime.IsZero():
+		if err := deb.SetBuildTime(time.Unix(0, 0)); err != nil {
+			return err
+		}
+		deb.epochBuildTime = true
+	case !enable && deb.epochBuildTime:
+		return deb.SetBuildTime(time.Time{})
+	}
+	return nil
+}
+
+// now returns the build time when set, otherwise the current time
+func (deb *DebPkg) now() time.Time {
+	if deb.buildTime.IsZero() {
+		return time.Now()
+	}
+	return deb.buildTime
+}
+
+// SetCompression sets the compression of the control and data archive (default CompressionGzip).
+// It must be called before any file is added to the package.
+func (deb *DebPkg) SetCompression(c Compression) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if err := deb.data.tgz.SetCompression(string(c)); err != nil {
+		return err
+	}
+	return deb.control.tgz.SetCompression(string(c))
+}
+
+// SetCompressionConcurrency sets the amount of workers compressing the data archive in parallel, zero uses
+// runtime.GOMAXPROCS and 1 is single-threaded (default). The gzip and xz archives are split in independently
+// compressed blocks of a single stream as done by pigz and xz --threads, for zstd the encoder overlaps the
+// compression of consecutive blocks. It must be called before any file is added to the package.
+func (deb *DebPkg) SetCompressionConcurrency(workers int) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if workers < 0 {
+		return fmt.Errorf("invalid compression concurrency %d", workers)
+	}
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return deb.data.tgz.SetConcurrency(workers)
 }
 
-// Close closes the File (and removes the intermediate files), rendering it unusable for I/O. It returns an error, if any.
+// Close removes the intermediate files, rendering the package unusable for I/O. It must be called when the
+// package is not needed anymore, also after a failed build. Calling Close more than once is a no-op.
 func (deb *DebPkg) Close() error {
 	if deb.err == ErrClosed {
-		return deb.err
+		return nil
 	}
+	deb.err = ErrClosed
+	return deb.removeArchives()
+}
+
+// Reset discards the content, settings and error of the package and removes its intermediate files.
+// Afterwards the package is empty as returned by New or NewInMemory and can be used for a new build.
+func (deb *DebPkg) Reset() error {
+	newArchive := deb.newArchive
+	err := deb.removeArchives()
+	*deb = DebPkg{}
+	deb.init(newArchive)
+	return err
+}
+
+// removeArchives removes the control and data archives, the first error is returned
+func (deb *DebPkg) removeArchives() error {
+	var err error
 	if deb.control.tgz != nil {
-		deb.control.tgz.Remove()
+		err = deb.control.tgz.Remove()
 	}
 	if deb.data.tgz != nil {
-		deb.data.tgz.Remove()
+		if derr := deb.data.tgz.Remove(); err == nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// finalize writes the control and data archives on the first write, the content is frozen afterwards
+// and all writes share the archives
+func (deb *DebPkg) finalize(ctx context.Context) error {
+	if deb.err != nil {
+		return deb.err
+	}
+	if deb.written {
+		return nil
+	}
+	if err := deb.withContext(ctx, deb.writeControlData); err != nil {
+		return deb.setError(err)
+	}
+	deb.written = true
+	return nil
+}
+
+// modifiable returns the package error or ErrWritten when the content is frozen by a write
+func (deb *DebPkg) modifiable() error {
+	if deb.err != nil {
+		return deb.err
+	}
+	if deb.written {
+		return ErrWritten
 	}
-	deb.err = ErrClosed // FIXME make deb.SetError work...
 	return nil
 }
 
-// writeControlData writes the control.tar.gz
+// writeControlData writes the control.tar.* and data.tar.*
 func (deb *DebPkg) writeControlData() error {
-	err := deb.control.verify()
-	if err != nil {
+	for _, err := range deb.control.validate() {
+		if verr, ok := err.(*ValidationError); !ok || !verr.Warning {
+			return err
+		}
+	}
+
+	if err := deb.addChangelog(); err != nil {
 		return err
 	}
+	if err := deb.addCopyright(); err != nil {
+		return err
+	}
+
+	if err := deb.data.flush(); err != nil {
+		return fmt.Errorf("error while writing data%s: %w", deb.data.tgz.Extension(), err)
+	}
 
-	err = deb.control.finalizeControlFile(&deb.data)
+	err := deb.control.finalizeControlFile(&deb.data)
 	if err != nil {
-		return fmt.Errorf("error while creating control.tar.gz: %s", err)
+		return fmt.Errorf("error while creating control%s: %w", deb.control.tgz.Extension(), err)
 	}
 
 	if err := deb.control.tgz.Close(); err != nil {
-		return fmt.Errorf("cannot close tgz writer: %v", err)
+		return fmt.Errorf("cannot close tgz writer: %w", err)
 	}
 
 	if err := deb.data.tgz.Close(); err != nil {
-		return fmt.Errorf("cannot close tgz writer: %v", err)
+		return fmt.Errorf("cannot close tgz writer: %w", err)
 	}
 	return nil
 }
 
-// Write the debian package to the filename
+// Write the debian package to the filename. The first write freezes the content of the package, it can be
+// written again (also signed) to other destinations until Close is called.
 func (deb *DebPkg) Write(filename string) error {
-	if deb.err != nil {
-		return deb.err
-	}
-	if err := deb.writeControlData(); err != nil {
-		deb.setError(err)
+	return deb.WriteContext(context.Background(), filename)
+}
+
+// WriteContext writes the debian package to the filename, the build is aborted with the context error when
+// the context is cancelled and the partially written file is removed
+func (deb *DebPkg) WriteContext(ctx context.Context, filename string) error {
+	if err := deb.finalize(ctx); err != nil {
 		return err
 	}
 	if filename == "" {
-		filename = deb.GetFilename()
+		var err error
+		if filename, err = deb.Filename(); err != nil {
+			return err
+		}
 	}
-	err := deb.createDebAr(filename)
-	deb.setError(err)
-	deb.Close()
-	return err
+	return deb.withContext(ctx, func() error {
+		return deb.createDebAr(filename, "")
+	})
+}
+
+// WriteTo writes the debian package to w, it implements io.WriterTo. The package can be written again like Write.
+func (deb *DebPkg) WriteTo(w io.Writer) (int64, error) {
+	return deb.WriteToContext(context.Background(), w)
+}
+
+// WriteToContext writes the debian package to w, the build is aborted with the context error when the context
+// is cancelled
+func (deb *DebPkg) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	if err := deb.finalize(ctx); err != nil {
+		return 0, err
+	}
+	cw := &countWriter{w: w}
+	err := deb.withContext(ctx, func() error {
+		return deb.writeDebAr(cw, "")
+	})
+	return cw.n, err
 }
 
 // GetFilename calculates the filename based on name, version and architecture
 // SetName("foo")
-// SetVersion("1.33.7")
+// SetVersion("1:1.33.7-1")
 // SetArchitecture("amd64")
-// Generates filename "foo-1.33.7_amd64.deb"
+// Generates filename "foo-1.33.7-1_amd64.deb", the epoch is omitted as is common for Debian filenames.
+// The extension is "udeb" or "ddeb" for the other package types. See Filename for the canonical Debian
+// filename and custom formats.
 func (deb *DebPkg) GetFilename() string {
+	ext := debianFileExtension
+	if deb.control.info.packageType != "" {
+		ext = string(deb.control.info.packageType)
+	}
+	version := deb.control.version()
+	if v, err := ParseVersion(version); err == nil {
+		v.Epoch = 0
+		version = v.String()
+	}
 	return fmt.Sprintf("%s-%s_%s.%s",
 		deb.control.info.name,
-		deb.control.info.version.full,
+		version,
 		deb.control.info.architecture,
-		debianFileExtension)
+		ext)
 }
 
 // MarkConfigFile marks configuration files in the debian package
 func (deb *DebPkg) MarkConfigFile(dest string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
 	return deb.control.markConfigFile(dest)
 }
 
 // AddFile adds a file by filename to the package
 func (deb *DebPkg) AddFile(filename string, dest ...string) error {
-	if deb.err != nil {
-		return deb.err
+	return deb.AddFileContext(context.Background(), filename, dest...)
+}
+
+// AddFileContext adds a file by filename to the package, the compression of the file is aborted with the
+// context error when the context is cancelled and the package is unusable afterwards
+func (deb *DebPkg) AddFileContext(ctx context.Context, filename string, dest ...string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
 	}
-	return deb.setError(deb.data.addFile(filename, dest...))
+	return deb.setError(deb.withContext(ctx, func() error {
+		destfilename := filename
+		if len(dest) > 0 && len(dest[0]) > 0 {
+			destfilename = dest[0]
+		}
+		return fileError("add file", filename, destfilename, deb.data.addFile(filename, dest...))
+	}))
 }
 
 // AddFileString adds a file to the package with the provided content
 func (deb *DebPkg) AddFileString(contents, dest string) error {
-	if deb.err != nil {
-		return deb.err
+	if err := deb.modifiable(); err != nil {
+		return err
 	}
-	return deb.setError(deb.data.addFileString(contents, dest))
+	return deb.setError(fileError("add file", "", dest, deb.data.addFileString(contents, dest)))
 }
 
-// AddEmptyDirectory adds a empty directory to the package
-func (deb *DebPkg) AddEmptyDirectory(dir string) error {
-	if deb.err != nil {
-		return deb.err
+// AddFileWithAttributes adds a file by filename to dest (filename when empty) with explicit mode and ownership
+func (deb *DebPkg) AddFileWithAttributes(filename, dest string, attr FileAttributes) error {
+	if err := deb.modifiable(); err != nil {
+		return err
 	}
-	return deb.setError(deb.data.addDirectory(dir))
+	return deb.setError(fileError("add file", filename, dest, deb.data.addFileAttr(filename, dest, attr.attr())))
 }
 
-// AddDirectory adds a directory recursive to the package
-func (deb *DebPkg) AddDirectory(dir string) error {
-	if deb.err != nil {
-		return deb.err
+// AddFileStringWithAttributes adds a file with the provided content with explicit mode and ownership
+func (deb *DebPkg) AddFileStringWithAttributes(contents, dest string, attr FileAttributes) error {
+	if err := deb.modifiable(); err != nil {
+		return err
 	}
+	return deb.setError(fileError("add file", "", dest, deb.data.addFileStringAttr(contents, dest, attr.attr())))
+}
 
-	deb.data.addDirectory(dir)
+// AddEmptyDirectoryWithAttributes adds a empty directory with explicit mode and ownership.
+// The directory must be added before any of its contents.
+func (deb *DebPkg) AddEmptyDirectoryWithAttributes(dir string, attr FileAttributes) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	return deb.setError(fileError("add directory", "", dir, deb.data.addDirectoryAttr(dir, attr.attr())))
+}
 
-	return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if path == "." || path == ".." || dir == path {
-			return nil
-		}
-		if f.IsDir() {
-			if err := deb.data.addDirectory(path); err != nil {
-				return deb.setError(err)
-			}
-			return deb.AddDirectory(path)
-		}
+// AddSymlink adds a symbolic link at dest pointing to target. E.g: AddSymlink("/opt/foo/bin/foo", "/usr/bin/foo")
+func (deb *DebPkg) AddSymlink(target, dest string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	return deb.setError(fileError("add symlink", "", dest, deb.data.addSymlink(target, dest)))
+}
 
-		return deb.setError(deb.AddFile(path))
-	})
+// AddHardlink adds a hard link at dest to target, the target must be added to the package before
+func (deb *DebPkg) AddHardlink(target, dest string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	return deb.setError(fileError("add hardlink", "", dest, deb.data.addHardlink(target, dest)))
+}
+
+// AddEmptyDirectory adds a empty directory to the package
+func (deb *DebPkg) AddEmptyDirectory(dir string) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	return deb.setError(fileError("add directory", "", dir, deb.data.addDirectory(dir)))
+}
+
+// AddDirectory adds a directory recursive to the package, symbolic links are preserved
+func (deb *DebPkg) AddDirectory(dir string) error {
+	return deb.AddDirectoryWithOptions(dir, DirectoryOptions{})
+}
+
+// AddDirectoryContext adds a directory recursive to the package, the walk is aborted with the context error
+// when the context is cancelled and the package is unusable afterwards
+func (deb *DebPkg) AddDirectoryContext(ctx context.Context, dir string) error {
+	return deb.AddDirectoryWithOptionsContext(ctx, dir, DirectoryOptions{})
 }
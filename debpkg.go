@@ -11,8 +11,17 @@ import (
 // GetArchitecture gets the current build.Default.GOARCH in debian-form
 func GetArchitecture() string {
 	arch := build.Default.GOARCH
-	if arch == "386" {
+	switch arch {
+	case "386":
 		return "i386"
+	case "arm":
+		return "armhf"
+	case "mipsle":
+		return "mipsel"
+	case "mips64le":
+		return "mips64el"
+	case "ppc64le":
+		return "ppc64el"
 	}
 	return arch
 }
@@ -5,13 +5,21 @@
 package debpkg
 
 import (
+	"archive/tar"
+	"bytes"
+	"errors"
 	"fmt"
 	"go/build"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xor-gate/debpkg/internal/test"
 )
 
@@ -63,11 +71,29 @@ func testReadWithLintian(t *testing.T, filename string) error {
 	return err
 }
 
+// testSetMaintainer sets the maintainer and short description which are mandatory on write
+func testSetMaintainer(deb *DebPkg) {
+	deb.SetMaintainer("Foo Bar")
+	deb.SetMaintainerEmail("foo@bar.com")
+	deb.SetShortDescription("debpkg test package")
+}
+
+// testNewPkg creates a package which can be written with the name, version and architecture
+func testNewPkg(name, version, arch string) *DebPkg {
+	deb := New()
+	deb.SetName(name)
+	deb.SetVersion(version)
+	deb.SetArchitecture(arch)
+	testSetMaintainer(deb)
+	return deb
+}
+
 // TestDirectory verifies adding a single directory recursive to the package
 func TestAddDirectory(t *testing.T) {
 	deb := New()
 	defer deb.Close()
 	deb.SetName("debpkg-test-add-directory")
+	testSetMaintainer(deb)
 	deb.SetArchitecture("all")
 
 	assert.Nil(t, deb.AddDirectory("internal"))
@@ -99,7 +125,13 @@ func TestWrite(t *testing.T) {
 
 	assert.Nil(t, testWrite(t, deb))
 
-	// Try to Write again on implicit closed package
+	// Write again, the content is frozen after the first write
+	assert.Nil(t, testWrite(t, deb))
+	assert.Equal(t, ErrWritten, deb.AddFileString("too late", "/real/late.txt"))
+	assert.Equal(t, ErrWritten, deb.SetBuildTime(time.Unix(1500000000, 0)))
+
+	// Try to Write again on closed package
+	assert.Nil(t, deb.Close())
 	assert.Equal(t, ErrClosed, testWrite(t, deb))
 }
 
@@ -110,7 +142,152 @@ func TestWriteError(t *testing.T) {
 	assert.NotNil(t, deb.Write(""), "deb.Write should return nil")
 
 	deb.control.info.name = "pkg"
-	assert.Equal(t, fmt.Errorf("empty package name"), deb.Write(""))
+	err := deb.Write("")
+	assert.EqualError(t, err, "Package: empty package name")
+	var verr *ValidationError
+	if assert.True(t, errors.As(err, &verr)) {
+		assert.Equal(t, "Package", verr.Field)
+	}
+}
+
+// TestClose verifies Close is idempotent and a closed package returns ErrClosed without panic
+func TestClose(t *testing.T) {
+	deb := New()
+	deb.SetName("debpkg-test-close")
+	deb.SetArchitecture("all")
+
+	assert.Nil(t, deb.Close())
+	assert.Nil(t, deb.Close())
+
+	assert.Equal(t, ErrClosed, deb.AddFileString("a", "/a"))
+	assert.Equal(t, ErrClosed, deb.AddDirectory("internal"))
+	assert.Equal(t, ErrClosed, deb.AddControlExtraString("postinst", "#!/bin/sh\n"))
+	assert.Equal(t, ErrClosed, deb.SetBuildTime(time.Unix(1500000000, 0)))
+	assert.Equal(t, ErrClosed, deb.Write(test.TempFile(t)))
+	assert.Equal(t, ErrClosed, deb.WriteSigned(test.TempFile(t), e))
+	_, err := deb.WriteTo(ioutil.Discard)
+	assert.Equal(t, ErrClosed, err)
+
+	err = errors.New("failure after close")
+	assert.Equal(t, err, deb.setError(err))
+	assert.Equal(t, ErrClosed, deb.err)
+}
+
+// TestReset verifies a package is reused for a new build after Reset
+func TestReset(t *testing.T) {
+	deb := NewInMemory()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-reset-a")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.AddFileString("a", "/usr/share/a"))
+	_, err := deb.WriteTo(ioutil.Discard)
+	require.Nil(t, err)
+
+	for _, closed := range []bool{false, true} {
+		if closed {
+			require.Nil(t, deb.Close())
+		}
+		require.Nil(t, deb.Reset())
+		assert.Equal(t, NewInMemory().GetFilename(), deb.GetFilename())
+
+		deb.SetName("debpkg-test-reset-b")
+		testSetMaintainer(deb)
+		deb.SetArchitecture("all")
+		require.Nil(t, deb.AddFileString("b", "/usr/share/b"))
+
+		var buf bytes.Buffer
+		_, err = deb.WriteTo(&buf)
+		require.Nil(t, err)
+
+		r, err := OpenReader(bytes.NewReader(buf.Bytes()))
+		require.Nil(t, err)
+		assert.Equal(t, "debpkg-test-reset-b", r.ControlField("Package"))
+
+		it, err := r.Data()
+		require.Nil(t, err)
+		var names []string
+		for {
+			hdr, err := it.Next()
+			if err != nil {
+				break
+			}
+			names = append(names, hdr.Name)
+		}
+		it.Close()
+		r.Close()
+		assert.Equal(t, []string{"usr", "usr/share", "usr/share/b"}, names)
+	}
+}
+
+// TestTempFilesRemoved verifies no intermediate files are left in the tempdir, also on error paths
+func TestTempFilesRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), "tempfiles")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	leftover := func() []string {
+		var names []string
+		entries, err := ioutil.ReadDir(dir)
+		require.Nil(t, err)
+		for _, fi := range entries {
+			names = append(names, fi.Name())
+		}
+		return names
+	}
+	newPkg := func() *DebPkg {
+		deb := New(dir)
+		deb.SetName("debpkg-test-tempfiles")
+		testSetMaintainer(deb)
+		deb.SetArchitecture("all")
+		return deb
+	}
+
+	// Unsigned and signed writes
+	deb := newPkg()
+	require.Nil(t, deb.AddFileString("a", "/a"))
+	assert.Len(t, leftover(), 2)
+	require.Nil(t, deb.Write(test.TempFile(t)))
+	require.Nil(t, deb.WriteSigned(test.TempFile(t), e))
+	assert.Nil(t, deb.Close())
+	assert.Empty(t, leftover())
+
+	// Validation error
+	deb = newPkg()
+	deb.SetName("")
+	assert.NotNil(t, deb.Write(test.TempFile(t)))
+	assert.Nil(t, deb.Close())
+	assert.Empty(t, leftover())
+
+	// Failed add
+	deb = newPkg()
+	assert.NotNil(t, deb.AddFile("does-not-exist"))
+	assert.Nil(t, deb.Close())
+	assert.Empty(t, leftover())
+
+	// Failed create of the package, the partial file is removed as well
+	deb = newPkg()
+	assert.NotNil(t, deb.Write(filepath.Join(dir, "missing", "foo.deb")))
+	assert.NotNil(t, deb.WriteSigned(filepath.Join(dir, "missing", "foo.deb"), e))
+	assert.Nil(t, deb.Close())
+	assert.Empty(t, leftover())
+
+	// Reset replaces the intermediate files
+	deb = newPkg()
+	require.Nil(t, deb.AddFileString("a", "/a"))
+	require.Nil(t, deb.Reset())
+	assert.Len(t, leftover(), 2)
+	assert.Nil(t, deb.Close())
+	assert.Empty(t, leftover())
+
+	// Invalid SOURCE_DATE_EPOCH fails before creating the intermediate files
+	os.Setenv("SOURCE_DATE_EPOCH", "invalid")
+	deb = New(dir)
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	assert.Empty(t, leftover())
+	assert.NotNil(t, deb.Write(test.TempFile(t)))
+	assert.Nil(t, deb.Close())
 }
 
 // ExampleDebPkgWrite demonstrates generating a simple package
@@ -148,6 +325,48 @@ func TestFilenameFromFullVersion(t *testing.T) {
 	assert.Equal(t, "foo-1.33.7_amd64.deb", deb.GetFilename())
 }
 
+// TestFilenameTemplate verifies the filename is generated from a template over the control fields
+func TestFilenameTemplate(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("foo")
+	deb.SetVersion("1:1.33.7-1")
+	deb.SetArchitecture("amd64")
+	deb.SetMultiArch(MultiArchSame)
+	filename, err := deb.Filename()
+	require.Nil(t, err)
+	assert.Equal(t, "foo-1.33.7-1_amd64.deb", filename)
+
+	require.Nil(t, deb.SetFilenameTemplate(CanonicalFilenameTemplate))
+	filename, err = deb.Filename()
+	require.Nil(t, err)
+	assert.Equal(t, "foo_1.33.7-1_amd64.deb", filename)
+	assert.Equal(t, "foo-1.33.7-1_amd64.deb", deb.GetFilename())
+
+	require.Nil(t, deb.SetFilenameTemplate("{{.Package}}-{{.FullVersion}}-{{index .Fields \"Multi-Arch\"}}.{{.Extension}}"))
+	filename, err = deb.Filename()
+	require.Nil(t, err)
+	assert.Equal(t, "foo-1:1.33.7-1-same.deb", filename)
+
+	require.Nil(t, deb.SetFilenameTemplate(""))
+	filename, err = deb.Filename()
+	require.Nil(t, err)
+	assert.Equal(t, "foo-1.33.7-1_amd64.deb", filename)
+
+	assert.NotNil(t, deb.SetFilenameTemplate("{{.Package"))
+	assert.NotNil(t, deb.SetFilenameTemplate("{{.Unknown}}"))
+
+	// Failures while rendering and path separators are reported by Filename and Write
+	for _, text := range []string{"{{slice .Package 0 (len .Version)}}.deb", "../{{.Package}}.deb", "{{.Package}}\\{{.Version}}.deb", "{{.Extension}}/"} {
+		require.Nil(t, deb.SetFilenameTemplate(text), text)
+		_, err := deb.Filename()
+		assert.NotNil(t, err, text)
+	}
+	testSetMaintainer(deb)
+	assert.NotNil(t, deb.Write(""))
+}
+
 // TestGetArchitecture checks the current build.Default.GOARCH compatible debian architecture
 func TestGetArchitecture(t *testing.T) {
 	// On debian 386 GOARCH is presented as i386
@@ -161,3 +380,383 @@ func TestGetArchitecture(t *testing.T) {
 		assert.Equal(t, build.Default.GOARCH, GetArchitecture())
 	}
 }
+
+// testReproduciblePkg adds the content of a reproducible package, the added file has the modification time
+func testReproduciblePkg(t *testing.T, deb *DebPkg, mtime time.Time) {
+	deb.SetName("debpkg-test-reproducible")
+	testSetMaintainer(deb)
+	deb.SetVersion("0.0.1")
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.SetReproducible(true))
+	require.Nil(t, deb.SetBuildTime(time.Unix(1500000000, 0)))
+
+	filename, err := test.WriteTempFile(t.Name()+"-debpkg.go", "package debpkg\n")
+	require.Nil(t, err)
+	require.Nil(t, os.Chtimes(filename, mtime, mtime))
+
+	assert.Nil(t, deb.AddFileString("b", "/usr/share/b"))
+	assert.Nil(t, deb.AddFile(filename, "/usr/share/debpkg.go"))
+	assert.Nil(t, deb.AddFileString("a", "/etc/a"))
+}
+
+// testWriteReproducible builds the same package into filename
+func testWriteReproducible(t *testing.T, filename string, mtime time.Time) {
+	deb := New()
+	defer deb.Close()
+	testReproduciblePkg(t, deb, mtime)
+	assert.Nil(t, deb.Write(filename))
+}
+
+// TestWriteReproducible verifies two builds of the same package are byte identical with sorted entries
+func TestWriteReproducible(t *testing.T) {
+	f1 := test.TempFile(t)
+	f2 := test.TempDir() + string(os.PathSeparator) + t.Name() + "-2.deb"
+
+	// The modification times of the added file after the build time are clamped
+	testWriteReproducible(t, f1, time.Unix(1600000000, 0))
+	testWriteReproducible(t, f2, time.Unix(1700000000, 0))
+
+	b1, err := ioutil.ReadFile(f1)
+	assert.Nil(t, err)
+	b2, err := ioutil.ReadFile(f2)
+	assert.Nil(t, err)
+	assert.Equal(t, b1, b2)
+
+	r, err := Open(f1)
+	assert.Nil(t, err)
+	defer r.Close()
+
+	it, err := r.Data()
+	assert.Nil(t, err)
+	defer it.Close()
+
+	var names []string
+	for {
+		hdr, err := it.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		assert.Equal(t, int64(1500000000), hdr.ModTime.Unix())
+		assert.Equal(t, "root", hdr.Uname)
+	}
+	assert.Equal(t, []string{"etc", "etc/a", "usr", "usr/share", "usr/share/b", "usr/share/debpkg.go"}, names)
+}
+
+// TestWriteTo verifies an in-memory package written to a buffer equals the package written to a file
+func TestWriteTo(t *testing.T) {
+	f := test.TempFile(t)
+	testWriteReproducible(t, f, time.Unix(1600000000, 0))
+	b1, err := ioutil.ReadFile(f)
+	require.Nil(t, err)
+
+	deb := NewInMemory()
+	defer deb.Close()
+	testReproduciblePkg(t, deb, time.Unix(1600000000, 0))
+
+	var buf bytes.Buffer
+	n, err := deb.WriteTo(&buf)
+	require.Nil(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, b1, buf.Bytes())
+
+	r, err := OpenReader(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	defer r.Close()
+	assert.Equal(t, "debpkg-test-reproducible", r.ControlField("Package"))
+
+	var again bytes.Buffer
+	_, err = deb.WriteTo(&again)
+	require.Nil(t, err)
+	assert.Equal(t, b1, again.Bytes())
+}
+
+// TestSourceDateEpoch verifies the build time is set from SOURCE_DATE_EPOCH
+func TestSourceDateEpoch(t *testing.T) {
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+	deb := New()
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	defer deb.Close()
+
+	assert.Equal(t, int64(1500000000), deb.buildTime.Unix())
+	assert.True(t, deb.data.sorted)
+
+	os.Setenv("SOURCE_DATE_EPOCH", "foo")
+	deb = New()
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	defer deb.Close()
+	assert.NotNil(t, deb.err)
+}
+
+// TestSetReproducible verifies the epoch build time is undone and late changes are rejected
+func TestSetReproducible(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	require.Nil(t, deb.SetReproducible(true))
+	assert.Equal(t, int64(0), deb.buildTime.Unix())
+	require.Nil(t, deb.SetReproducible(false))
+	assert.True(t, deb.buildTime.IsZero())
+	assert.False(t, deb.data.sorted)
+
+	// An explicit build time is kept
+	require.Nil(t, deb.SetBuildTime(time.Unix(1500000000, 0)))
+	require.Nil(t, deb.SetReproducible(true))
+	require.Nil(t, deb.SetReproducible(false))
+	assert.Equal(t, int64(1500000000), deb.buildTime.Unix())
+
+	require.Nil(t, deb.AddEmptyDirectory("/usr/share/foo"))
+	assert.NotNil(t, deb.SetReproducible(true))
+	assert.False(t, deb.data.sorted)
+
+	require.Nil(t, deb.Close())
+	assert.Equal(t, ErrClosed, deb.SetReproducible(true))
+}
+
+// TestAddDirectorySymlink verifies symlinks are preserved when adding a directory and excluded from md5sums
+func TestAddDirectorySymlink(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), t.Name())
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(dir+"/file", []byte("hello"), 0644))
+	assert.Nil(t, os.Symlink("file", dir+"/link"))
+
+	deb := New()
+	defer deb.Close()
+	deb.SetName("debpkg-test-add-directory-symlink")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+
+	assert.Nil(t, deb.AddDirectory(dir))
+	assert.Nil(t, deb.AddSymlink("/opt/foo/bin/foo", "/usr/bin/foo"))
+	assert.Nil(t, deb.AddHardlink(dir+"/file", "/usr/bin/hard"))
+	assert.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	assert.Nil(t, err)
+	defer r.Close()
+
+	dest := strings.Trim(dir, "/")
+	assert.Equal(t, map[string]string{
+		dest + "/file": "5d41402abc4b2a76b9719d911017c592",
+		"usr/bin/hard": "5d41402abc4b2a76b9719d911017c592",
+	}, r.MD5Sums())
+
+	it, err := r.Data()
+	assert.Nil(t, err)
+	defer it.Close()
+
+	links := make(map[string]string)
+	for {
+		hdr, err := it.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			links[hdr.Name] = hdr.Linkname
+		}
+	}
+	assert.Equal(t, map[string]string{
+		dest + "/link": "file",
+		"usr/bin/foo":  "/opt/foo/bin/foo",
+		"usr/bin/hard": dest + "/file",
+	}, links)
+}
+
+// TestAddHardlinkSorted verifies hardlinks are written after their target when the entries are sorted
+func TestAddHardlinkSorted(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+	deb.SetName("debpkg-test-add-hardlink-sorted")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.SetReproducible(true))
+
+	assert.Nil(t, deb.AddFileString("x", "/z/file"))
+	assert.Nil(t, deb.AddHardlink("/z/file", "/a/link"))
+	assert.Nil(t, deb.AddHardlink("/a/link", "/b/link"))
+	assert.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	assert.Nil(t, err)
+	defer r.Close()
+	it, err := r.Data()
+	assert.Nil(t, err)
+	defer it.Close()
+
+	var names []string
+	links := make(map[string]string)
+	for {
+		hdr, err := it.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeLink {
+			links[hdr.Name] = hdr.Linkname
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "z", "z/file", "a/link", "b/link"}, names)
+	assert.Equal(t, map[string]string{"a/link": "z/file", "b/link": "z/file"}, links)
+}
+
+// TestAddFileWithAttributes verifies the mode and ownership overrides end up in the data archive
+func TestAddFileWithAttributes(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+	deb.SetName("debpkg-test-add-file-with-attributes")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+
+	assert.Nil(t, deb.AddEmptyDirectoryWithAttributes("/var/lib/foo", FileAttributes{Mode: 0750 | os.ModeSticky, Owner: "foo", Gid: 42}))
+	assert.Nil(t, deb.AddFileWithAttributes("Makefile", "/usr/bin/foo", FileAttributes{Mode: 0755 | os.ModeSetuid}))
+	assert.Nil(t, deb.AddFileStringWithAttributes("secret", "/etc/foo.conf", FileAttributes{Mode: 0640, Group: "adm"}))
+	assert.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	assert.Nil(t, err)
+	defer r.Close()
+
+	it, err := r.Data()
+	assert.Nil(t, err)
+	defer it.Close()
+
+	hdrs := make(map[string]*tar.Header)
+	for {
+		hdr, err := it.Next()
+		if err != nil {
+			break
+		}
+		hdrs[hdr.Name] = hdr
+	}
+
+	assert.Equal(t, int64(01750), hdrs["var/lib/foo"].Mode&07777)
+	assert.Equal(t, "foo", hdrs["var/lib/foo"].Uname)
+	assert.Equal(t, 42, hdrs["var/lib/foo"].Gid)
+	assert.Equal(t, "", hdrs["var/lib/foo"].Gname)
+	assert.Equal(t, int64(04755), hdrs["usr/bin/foo"].Mode&07777)
+	assert.Equal(t, "root", hdrs["usr/bin/foo"].Uname)
+	assert.Equal(t, int64(0640), hdrs["etc/foo.conf"].Mode&07777)
+	assert.Equal(t, "adm", hdrs["etc/foo.conf"].Gname)
+	assert.Equal(t, int64(0755), hdrs["usr/bin"].Mode&07777)
+}
+
+// TestAddDirectoryWithOptions verifies the destination mapping, include/exclude globs and ignore file
+func TestAddDirectoryWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), t.Name())
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"bin/foo", "lib/libfoo.so", "lib/libfoo.a", "lib/sub/libbar.so", "tmp/cache.so", "build/foo.o", ".debignore"} {
+		require.Nil(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".debignore"), []byte("# comment\nbuild/\n.debignore\n"), 0644))
+
+	deb := New()
+	defer deb.Close()
+
+	require.Nil(t, deb.AddDirectoryWithOptions(dir, DirectoryOptions{
+		Dest:       "/opt/foo",
+		Exclude:    []string{"/tmp/", "*.a"},
+		IgnoreFile: ".debignore",
+	}))
+	assert.Equal(t, []string{"/opt", "/opt/foo", "/opt/foo/bin", "/opt/foo/lib", "/opt/foo/lib/sub"}, deb.data.dirs)
+	assert.Contains(t, deb.data.md5sums, "  opt/foo/bin/foo\n")
+	assert.Contains(t, deb.data.md5sums, "  opt/foo/lib/libfoo.so\n")
+	assert.Contains(t, deb.data.md5sums, "  opt/foo/lib/sub/libbar.so\n")
+	assert.NotContains(t, deb.data.md5sums, "libfoo.a")
+	assert.NotContains(t, deb.data.md5sums, "cache.so")
+	assert.NotContains(t, deb.data.md5sums, "foo.o")
+	assert.NotContains(t, deb.data.md5sums, ".debignore")
+
+	deb = New()
+	defer deb.Close()
+
+	require.Nil(t, deb.AddDirectoryWithOptions(dir, DirectoryOptions{
+		Dest:    "/usr/lib/foo",
+		Include: []string{"lib/**/*.so"},
+	}))
+	assert.Equal(t, []string{"/usr", "/usr/lib", "/usr/lib/foo", "/usr/lib/foo/lib", "/usr/lib/foo/lib/sub"}, deb.data.dirs)
+	assert.Equal(t, 2, strings.Count(deb.data.md5sums, "\n"))
+}
+
+// TestAddDirectoryFollowSymlinks verifies symlinks are resolved when requested and loops are detected
+func TestAddDirectoryFollowSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir(test.TempDir(), t.Name())
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "real"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "real", "file"), []byte("hello"), 0644))
+	require.Nil(t, os.Symlink("real", filepath.Join(dir, "link")))
+
+	deb := New()
+	defer deb.Close()
+
+	require.Nil(t, deb.AddDirectoryWithOptions(dir, DirectoryOptions{Dest: "/opt/foo", FollowSymlinks: true}))
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592  opt/foo/link/file\n5d41402abc4b2a76b9719d911017c592  opt/foo/real/file\n", deb.data.md5sums)
+
+	require.Nil(t, os.Symlink("..", filepath.Join(dir, "real", "loop")))
+
+	deb = New()
+	defer deb.Close()
+
+	assert.NotNil(t, deb.AddDirectoryWithOptions(dir, DirectoryOptions{Dest: "/opt/foo", FollowSymlinks: true}))
+}
+
+// TestPackageTypeUdeb verifies an udeb has the Package-Type field and no md5sums
+func TestPackageTypeUdeb(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-udeb")
+	testSetMaintainer(deb)
+	deb.SetVersion("1.0")
+	deb.SetArchitecture("amd64")
+	deb.SetPackageType(PackageTypeUdeb)
+	assert.Equal(t, "debpkg-test-udeb-1.0_amd64.udeb", deb.GetFilename())
+	require.Nil(t, deb.AddFileString("hello", "/usr/lib/foo/hello"))
+	require.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	require.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, "udeb", r.ControlField("Package-Type"))
+	assert.Empty(t, r.MD5Sums())
+	_, ok := r.ControlExtra("sha256sums")
+	assert.False(t, ok)
+}
+
+// TestPackageTypeDdeb verifies a ddeb is marked as debug symbols package with the build-ids of the data
+func TestPackageTypeDdeb(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-dbgsym")
+	testSetMaintainer(deb)
+	deb.SetVersion("1.0")
+	deb.SetArchitecture("amd64")
+	deb.SetPackageType(PackageTypeDdeb)
+	assert.Equal(t, "debpkg-test-dbgsym-1.0_amd64.ddeb", deb.GetFilename())
+	require.Nil(t, deb.AddFileString("b", "/usr/lib/debug/.build-id/fe/0123456789.debug"))
+	require.Nil(t, deb.AddFileString("a", "/usr/lib/debug/.build-id/3a/5e2b1c.debug"))
+	require.Nil(t, deb.AddFileString("c", "/usr/lib/debug/.build-id/zz/notanid.debug"))
+	require.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	require.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, "ddeb", r.ControlField("Package-Type"))
+	assert.Equal(t, "debug-symbols", r.ControlField("Auto-Built-Package"))
+	assert.Equal(t, "3a5e2b1c fe0123456789", r.ControlField("Build-Ids"))
+	assert.Len(t, r.MD5Sums(), 3)
+
+	deb = New()
+	defer deb.Close()
+	deb.SetName("debpkg-test-dbgsym")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("amd64")
+	deb.SetPackageType(PackageTypeDdeb)
+	deb.SetBuildIDs("ABC")
+	assert.Len(t, deb.Validate(), 1)
+}
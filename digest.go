@@ -6,35 +6,75 @@ package debpkg
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/md5"
 	"crypto/sha1"
+	_ "crypto/sha256" // Hash policy crypto.SHA256
+	_ "crypto/sha512" // Hash policy crypto.SHA512
 	"fmt"
 	"hash"
 	"io"
-	"os"
 	"time"
 
+	"github.com/xor-gate/debpkg/internal/targzip"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
 	"golang.org/x/crypto/openpgp/packet"
 )
 
-const digestDefaultHash = crypto.SHA1
+const digestDefaultHash = crypto.SHA256
 const digestVersion = 4
 const digestRole = "builder"
 
+// digestHashes are the supported hash policies with their name as used for "<name>sums"
+var digestHashes = map[crypto.Hash]string{
+	crypto.SHA1:   "sha1",
+	crypto.SHA256: "sha256",
+	crypto.SHA512: "sha512",
+}
+
+// digestChecksumsFields are the digest fields for the hash policy checksums
+var digestChecksumsFields = map[crypto.Hash]string{
+	crypto.SHA256: "Checksums-Sha256",
+	crypto.SHA512: "Checksums-Sha512",
+}
+
 // Digest file for GPG signing
 type digest struct {
-	plaintext string // Plaintext package digest (empty when unsigned)
-	clearsign string // GPG clearsigned package digest (empty when unsigned)
-	signer    string // Name <email>
-	date      string // Mon Jan 2 15:04:05 2006 (time.ANSIC)
-	files     string // Multiple "\t<md5sum> <sha1sum> <size> <filename>"
+	plaintext string      // Plaintext package digest (empty when unsigned)
+	clearsign string      // GPG clearsigned package digest (empty when unsigned)
+	signer    string      // Name <email>
+	date      string      // Mon Jan 2 15:04:05 2006 (time.ANSIC)
+	hash      crypto.Hash // Hash policy for signing and checksums
+	files     string      // Multiple "\t<md5sum> <sha1sum> <size> <filename>"
 	// E.g:
 	//       3cf918272ffa5de195752d73f3da3e5e 7959c969e092f2a5a8604e2287807ac5b1b384ad 4 debian-binary
 	//       79bb73dbb522dc1a2dd1b9c2ec89fc79 26d29d15aad5c0e051d07571e28da2bc0009707e 366 control.tar.gz
 	//       e1a6e48c95a760170029ef7872cec994 e02ed99e5c4fd847bde12b4c2c30dd814b26ec27 136 data.tar.gz
+	checksums string // Multiple "\t<hashsum> <size> <filename>" for hash policies other than SHA1
+}
+
+// SetHash sets the hash policy used for the signature, the digest checksums and the data
+// checksums stored next to md5sums. Supported are crypto.SHA1, crypto.SHA256 (default) and crypto.SHA512.
+// The hash can not be changed after files are added as their checksums are already calculated.
+// NOTE: With crypto.SHA1 only the dpkg-sig compatible md5 and sha1 digest is created
+func (deb *DebPkg) SetHash(h crypto.Hash) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+	if _, ok := digestHashes[h]; !ok {
+		return fmt.Errorf("unsupported hash: %v", h)
+	}
+	if deb.data.md5sums != "" && h != deb.digest.hash {
+		return fmt.Errorf("cannot change hash to %v after files are added", h)
+	}
+	deb.digest.hash = h
+	deb.data.hash = 0
+	if h != crypto.SHA1 {
+		deb.data.hash = h
+	}
+	return nil
 }
 
 // Create unsigned digest file at toplevel of deb package
@@ -46,6 +86,9 @@ Date: %s
 Role: %s
 Files: 
 %s`
+	deb.digest.files = ""
+	deb.digest.checksums = ""
+
 	// debian-binary
 	md5sum, _ := digestCalcDataHash(bytes.NewBuffer([]byte(deb.debianBinary)), md5.New())
 	sha1sum, _ := digestCalcDataHash(bytes.NewBuffer([]byte(deb.debianBinary)), sha1.New())
@@ -54,30 +97,46 @@ Files:
 		sha1sum,
 		len(deb.debianBinary),
 		"debian-binary")
+	if field, ok := digestChecksumsFields[deb.digest.hash]; ok {
+		hashsum, _ := digestCalcDataHash(bytes.NewBuffer([]byte(deb.debianBinary)), deb.digest.hash.New())
+		deb.digest.checksums = field + ": \n"
+		deb.digest.checksums += fmt.Sprintf("\t%x %d %s\n",
+			hashsum,
+			len(deb.debianBinary),
+			"debian-binary")
+	}
 
-	deb.digestAddFile("control.tar.gz", deb.control.tgz.Name(), deb.control.tgz.Size())
-	deb.digestAddFile("data.tar.gz", deb.data.tgz.Name(), deb.data.tgz.Size())
+	deb.digestAddFile("control"+deb.control.tgz.Extension(), deb.control.tgz)
+	deb.digestAddFile("data"+deb.data.tgz.Extension(), deb.data.tgz)
 
 	return fmt.Sprintf(digestFileTmpl,
 		digestVersion,
 		deb.digest.signer,
 		deb.digest.date,
 		digestRole,
-		deb.digest.files)
+		deb.digest.files) + deb.digest.checksums
 }
 
-func (deb *DebPkg) digestAddFile(filename, filepath string, size int64) {
-	md5sum, _ := digestCalcDataHashFromFile(filepath, md5.New())
-	sha1sum, _ := digestCalcDataHashFromFile(filepath, sha1.New())
+func (deb *DebPkg) digestAddFile(filename string, tgz *targzip.TarGzip) {
+	size := tgz.Size()
+	md5sum, _ := digestCalcDataHashFromArchive(tgz, md5.New())
+	sha1sum, _ := digestCalcDataHashFromArchive(tgz, sha1.New())
 	deb.digest.files += fmt.Sprintf("\t%x %x %d %s\n",
 		md5sum,
 		sha1sum,
 		size,
 		filename)
+	if deb.digest.checksums != "" {
+		hashsum, _ := digestCalcDataHashFromArchive(tgz, deb.digest.hash.New())
+		deb.digest.checksums += fmt.Sprintf("\t%x %d %s\n",
+			hashsum,
+			size,
+			filename)
+	}
 }
 
-func digestCalcDataHashFromFile(filename string, hash hash.Hash) (string, error) {
-	f, err := os.Open(filename)
+func digestCalcDataHashFromArchive(tgz *targzip.TarGzip, hash hash.Hash) (string, error) {
+	f, err := tgz.Open()
 	if err != nil {
 		return "", err
 	}
@@ -95,42 +154,87 @@ func digestCalcDataHash(in io.Reader, hash hash.Hash) (string, error) {
 
 // WriteSigned package with GPG entity
 func (deb *DebPkg) WriteSigned(filename string, entity *openpgp.Entity) error {
+	return deb.WriteSignedContext(context.Background(), filename, entity)
+}
+
+// WriteSignedContext writes the package signed with GPG entity to the filename, the build is aborted with
+// the context error when the context is cancelled
+func (deb *DebPkg) WriteSignedContext(ctx context.Context, filename string, entity *openpgp.Entity) error {
+	if err := deb.finalize(ctx); err != nil {
+		return err
+	}
+	return deb.withContext(ctx, func() error {
+		if err := deb.sign(entity); err != nil {
+			return err
+		}
+		if filename == "" {
+			var err error
+			if filename, err = deb.Filename(); err != nil {
+				return err
+			}
+		}
+		return deb.createDebAr(filename, deb.digest.clearsign)
+	})
+}
+
+// WriteSignedTo writes the package signed with GPG entity to w
+func (deb *DebPkg) WriteSignedTo(w io.Writer, entity *openpgp.Entity) (int64, error) {
+	return deb.WriteSignedToContext(context.Background(), w, entity)
+}
+
+// WriteSignedToContext writes the package signed with GPG entity to w, the build is aborted with the context
+// error when the context is cancelled
+func (deb *DebPkg) WriteSignedToContext(ctx context.Context, w io.Writer, entity *openpgp.Entity) (int64, error) {
+	if err := deb.finalize(ctx); err != nil {
+		return 0, err
+	}
+	cw := &countWriter{w: w}
+	err := deb.withContext(ctx, func() error {
+		if err := deb.sign(entity); err != nil {
+			return err
+		}
+		return deb.writeDebAr(cw, deb.digest.clearsign)
+	})
+	return cw.n, err
+}
+
+// sign creates the clearsigned digest of the finalized control and data archives
+func (deb *DebPkg) sign(entity *openpgp.Entity) error {
 	var buf bytes.Buffer
 	var cfg packet.Config
 	var signer string
-	cfg.DefaultHash = digestDefaultHash
+	cfg.DefaultHash = deb.digest.hash
+	if !deb.buildTime.IsZero() {
+		cfg.Time = deb.now
+	}
 
 	for id := range entity.Identities {
 		// TODO real search for keyid, need to investigate maybe a subkey?
 		signer = id
 	}
 
-	deb.digest.date = time.Now().Format(time.ANSIC)
+	deb.digest.date = deb.now().Format(time.ANSIC)
 	deb.digest.signer = signer
 
 	clearsign, err := clearsign.Encode(&buf, entity.PrivateKey, &cfg)
 	if err != nil {
-		return fmt.Errorf("error while signing: %s", err)
+		return fmt.Errorf("error while signing: %w", err)
 	}
 
-	if err := deb.writeControlData(); err != nil {
+	if err := deb.notify(Event{Stage: StageSign, Name: "digests.asc"}); err != nil {
 		return err
 	}
 
 	deb.digest.plaintext = createDigestFileString(deb)
 
 	if _, err = clearsign.Write([]byte(deb.digest.plaintext)); err != nil {
-		return fmt.Errorf("error from Write: %s", err)
+		return fmt.Errorf("error from Write: %w", err)
 	}
 
 	if err = clearsign.Close(); err != nil {
-		return fmt.Errorf("error from Close: %s", err)
+		return fmt.Errorf("error from Close: %w", err)
 	}
 
 	deb.digest.clearsign = buf.String()
-
-	if filename == "" {
-		filename = deb.GetFilename()
-	}
-	return deb.createDebAr(filename)
+	return nil
 }
@@ -5,7 +5,10 @@
 package debpkg
 
 import (
+	"crypto"
+
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xor-gate/debpkg/internal/test"
 	"golang.org/x/crypto/openpgp"
 	"testing"
@@ -31,6 +34,29 @@ Files:
 	d41d8cd98f00b204e9800998ecf8427e da39a3ee5e6b4b0d3255bfef95601890afd80709 0 data.tar.gz
 `
 
+	deb := New()
+	defer deb.Close()
+	assert.Nil(t, deb.SetHash(crypto.SHA1))
+	digest := createDigestFileString(deb)
+
+	assert.Equal(t, digest, digestExpect)
+}
+
+func TestDigestCreateEmptySHA256(t *testing.T) {
+	digestExpect := `Version: 4
+Signer: 
+Date: 
+Role: builder
+Files: 
+	3cf918272ffa5de195752d73f3da3e5e 7959c969e092f2a5a8604e2287807ac5b1b384ad 4 debian-binary
+	d41d8cd98f00b204e9800998ecf8427e da39a3ee5e6b4b0d3255bfef95601890afd80709 0 control.tar.gz
+	d41d8cd98f00b204e9800998ecf8427e da39a3ee5e6b4b0d3255bfef95601890afd80709 0 data.tar.gz
+Checksums-Sha256: 
+	d526eb4e878a23ef26ae190031b4efd2d58ed66789ac049ea3dbaf74c9df7402 4 debian-binary
+	e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 control.tar.gz
+	e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 0 data.tar.gz
+`
+
 	deb := New()
 	defer deb.Close()
 	digest := createDigestFileString(deb)
@@ -38,6 +64,55 @@ Files:
 	assert.Equal(t, digest, digestExpect)
 }
 
+func TestSetHash(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	assert.Equal(t, crypto.SHA256, deb.digest.hash)
+	assert.NotNil(t, deb.SetHash(crypto.MD5))
+	assert.Nil(t, deb.SetHash(crypto.SHA512))
+	assert.Equal(t, crypto.SHA512, deb.data.hash)
+
+	assert.Nil(t, deb.AddFileString("test", "/foo"))
+	assert.Equal(t, "ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db27ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff  foo\n", deb.data.hashsums)
+
+	assert.NotNil(t, deb.SetHash(crypto.SHA1))
+	assert.Nil(t, deb.SetHash(crypto.SHA512))
+	assert.Equal(t, crypto.SHA512, deb.data.hash)
+
+	deb = New()
+	defer deb.Close()
+	assert.Nil(t, deb.SetHash(crypto.SHA1))
+	assert.Equal(t, crypto.Hash(0), deb.data.hash)
+}
+
+// TestSetHashAfterAddFile verifies the hash can not change after files are added, the sums file would
+// otherwise be named after a different hash than its checksums
+func TestSetHashAfterAddFile(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+	deb.SetName("debpkg-test-set-hash-after-add-file")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+
+	assert.Nil(t, deb.AddFileString("test", "/foo"))
+	assert.NotNil(t, deb.SetHash(crypto.SHA512))
+	assert.Equal(t, crypto.SHA256, deb.digest.hash)
+	assert.Equal(t, crypto.SHA256, deb.data.hash)
+	assert.Nil(t, testWrite(t, deb))
+
+	r, err := Open(test.TempFile(t))
+	require.Nil(t, err)
+	defer r.Close()
+	_, ok := r.ControlExtra("sha512sums")
+	assert.False(t, ok)
+	sums, ok := r.ControlExtra("sha256sums")
+	assert.True(t, ok)
+	assert.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  foo\n", sums)
+
+	assert.Equal(t, ErrWritten, deb.SetHash(crypto.SHA256))
+}
+
 func TestWriteSigned(t *testing.T) {
 	deb := New()
 	defer deb.Close()
@@ -45,7 +120,7 @@ func TestWriteSigned(t *testing.T) {
 	deb.SetName("debpkg-test-signed")
 	deb.SetVersion("0.0.1")
 	deb.SetMaintainer("Foo Bar")
-	deb.SetArchitecture("any")
+	deb.SetArchitecture("all")
 	deb.SetMaintainerEmail("foo@bar.com")
 	deb.SetHomepage("https://foobar.com")
 	deb.SetShortDescription("some awesome foobar pkg")
@@ -0,0 +1,185 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/xor-gate/debpkg/internal/glob"
+	"github.com/xor-gate/debpkg/internal/targzip"
+)
+
+// DirectoryOptions controls how a host directory is mapped into the package.
+// Patterns use the .gitignore syntax and are matched against the slash separated path relative to
+// the source directory. A pattern without a "/" matches at any level and "**" matches any amount of directories.
+type DirectoryOptions struct {
+	Dest           string   // Destination in the package. E.g: "/opt/product", defaults to the source path
+	Include        []string // Only add files matching one of the patterns (all when empty). E.g: "*.so"
+	Exclude        []string // Skip files and directories matching one of the patterns. E.g: "*.o", "/tmp/"
+	IgnoreFile     string   // Name of a .gitignore-style file in the source directory with extra exclude patterns
+	FollowSymlinks bool     // Add the targets of symbolic links instead of the links
+}
+
+// directoryWalker walks a host directory and adds the entries to the package
+type directoryWalker struct {
+	data     *data
+	opts     DirectoryOptions
+	include  *glob.Ignore
+	exclude  *glob.Ignore
+	visiting map[string]bool // Real paths of the directories currently walked to detect symlink loops
+	cancel   func() error    // Reports the cancellation of the build context
+}
+
+// AddDirectoryWithOptions adds the directory src recursive to the package with destination mapping and filtering.
+// When include patterns are given only the parent directories of the included files are added.
+func (deb *DebPkg) AddDirectoryWithOptions(src string, opts DirectoryOptions) error {
+	return deb.AddDirectoryWithOptionsContext(context.Background(), src, opts)
+}
+
+// AddDirectoryWithOptionsContext is AddDirectoryWithOptions which stops walking with the context error
+// when the context is cancelled, the package is unusable afterwards
+func (deb *DebPkg) AddDirectoryWithOptionsContext(ctx context.Context, src string, opts DirectoryOptions) error {
+	if err := deb.modifiable(); err != nil {
+		return err
+	}
+
+	w := &directoryWalker{
+		data:     &deb.data,
+		opts:     opts,
+		visiting: make(map[string]bool),
+		cancel:   deb.ctxErr,
+	}
+
+	var err error
+	if w.include, err = glob.NewIgnore(opts.Include...); err != nil {
+		return fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if w.exclude, err = glob.NewIgnore(opts.Exclude...); err != nil {
+		return fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	if opts.IgnoreFile != "" {
+		ignore, err := glob.ReadIgnoreFile(filepath.Join(src, opts.IgnoreFile))
+		if err != nil {
+			return fmt.Errorf("invalid ignore file %s: %w", opts.IgnoreFile, err)
+		}
+		w.exclude.Merge(ignore)
+	}
+
+	return deb.setError(deb.withContext(ctx, func() error {
+		return fileError("add directory", src, w.opts.Dest, w.add(src))
+	}))
+}
+
+// add adds the directory src and walks it
+func (w *directoryWalker) add(src string) error {
+	dest := w.opts.Dest
+	if dest == "" {
+		dest = filepath.ToSlash(filepath.Clean(src))
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", src)
+	}
+	if w.include.Len() == 0 {
+		if err := w.data.addDirectory(dest); err != nil {
+			return err
+		}
+	}
+
+	return w.walk(src, dest, "")
+}
+
+// walk adds the entries of the host directory dir to dest, rel is the path relative to the source directory
+func (w *directoryWalker) walk(dir, dest, rel string) error {
+	if w.opts.FollowSymlinks {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if w.visiting[real] {
+			return fmt.Errorf("symlink loop at %s", dir)
+		}
+		w.visiting[real] = true
+		defer delete(w.visiting, real)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range entries {
+		if err := w.cancel(); err != nil {
+			return err
+		}
+		hostPath := filepath.Join(dir, fi.Name())
+		relPath := path.Join(rel, fi.Name())
+		destPath := path.Join(dest, fi.Name())
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				if !w.match(relPath, false) {
+					continue
+				}
+				target, err := os.Readlink(hostPath)
+				if err != nil {
+					return err
+				}
+				if err := w.data.addSymlink(target, destPath); err != nil {
+					return fileError("add symlink", hostPath, destPath, err)
+				}
+				continue
+			}
+			if fi, err = os.Stat(hostPath); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case fi.IsDir():
+			if w.exclude.Match(relPath, true) {
+				continue
+			}
+			if w.include.Len() == 0 {
+				if err := w.data.addDirectory(destPath); err != nil {
+					return err
+				}
+			}
+			if err := w.walk(hostPath, destPath, relPath); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if !w.match(relPath, false) {
+				continue
+			}
+			if err := w.data.addFileAttr(hostPath, destPath, targzip.Attr{}); err != nil {
+				return fileError("add file", hostPath, destPath, err)
+			}
+		default:
+			if w.match(relPath, false) {
+				return fmt.Errorf("unsupported file type %s", hostPath)
+			}
+		}
+	}
+
+	return nil
+}
+
+// match reports whether the relative path is included and not excluded
+func (w *directoryWalker) match(rel string, isDir bool) bool {
+	if w.exclude.Match(rel, isDir) {
+		return false
+	}
+	return w.include.Len() == 0 || w.include.Match(rel, isDir)
+}
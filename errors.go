@@ -5,26 +5,126 @@
 package debpkg
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"os"
 )
 
 // ErrClosed when the file I/O is requested and it is already closed
 var ErrClosed = errors.New("debpkg: Closed")
 
-// ErrIO is returned when any file I/O failed
+// ErrWritten is returned when the content is modified after the package is written
+var ErrWritten = errors.New("debpkg: package is already written")
+
+// ErrIO is returned when any file I/O failed, a FileError caused by the operating system matches it with errors.Is
 var ErrIO = errors.New("debpkg: I/O failed")
 
-// setError sets the package error when not nil
-// setting an error when the current error is ErrClosed it will panic
-func (deb *DebPkg) setError(err error) error {
-	if err == nil {
-		return nil
+// ErrUnsigned is returned when verifying a package without signature
+var ErrUnsigned = errors.New("debpkg: package is not signed")
+
+// ValidationError is returned when a control field violates the Debian policy
+type ValidationError struct {
+	Field   string // Control field name. E.g: "Package"
+	Err     error  // Description of the violation
+	Warning bool   // Recommendation of the policy which does not fail Write. E.g: a synopsis over 80 characters
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the description of the violation
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// FileError is returned when adding, reading or creating a file failed
+type FileError struct {
+	Op   string // Operation. E.g: "add file"
+	Src  string // Host path, empty when the content is not read from a file
+	Dest string // Path in the package or output filename
+	Err  error  // Cause. E.g: *os.PathError
+}
+
+func (e *FileError) Error() string {
+	msg := e.Op
+	if e.Src != "" {
+		msg += " " + e.Src
 	}
-	if deb.err == ErrClosed {
-		panic("debpkg: Trying to overwrite ErrClosed")
+	if e.Dest != "" && e.Dest != e.Src {
+		if e.Src != "" {
+			msg += " to"
+		}
+		msg += " " + e.Dest
 	}
-	if err != ErrClosed {
-		deb.err = err
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrIO and the cause is an operating system error
+func (e *FileError) Is(target error) bool {
+	if target != ErrIO {
+		return false
+	}
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	return errors.As(e.Err, &pathErr) || errors.As(e.Err, &linkErr) || errors.As(e.Err, &syscallErr)
+}
+
+// SpecError is returned when loading a debpkg.yml specfile failed, the line and column point to the
+// entry which failed (zero when unknown)
+type SpecError struct {
+	File   string // Specfile name
+	Line   int    // Line of the entry, starting at 1
+	Column int    // Column of the entry, starting at 1
+	Field  string // Key or entry in the specfile. E.g: "files[2]" or "compression"
+	Err    error  // Cause
+}
+
+func (e *SpecError) Error() string {
+	msg := e.File
+	if e.Line > 0 {
+		msg += fmt.Sprintf(":%d", e.Line)
+		if e.Column > 0 {
+			msg += fmt.Sprintf(":%d", e.Column)
+		}
+	}
+	if e.Field != "" {
+		msg += ": " + e.Field
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
+
+// fileError wraps err in a FileError, cancellation and errors which are already a FileError are returned as-is
+func fileError(op, src, dest string, err error) error {
+	var fe *FileError
+	if err == nil || err == ErrClosed || errors.As(err, &fe) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &FileError{Op: op, Src: src, Dest: dest, Err: err}
+}
+
+// setError sets the package error when not nil, a closed package keeps ErrClosed.
+// The error is returned unchanged.
+func (deb *DebPkg) setError(err error) error {
+	if err == nil || err == ErrClosed || err == ErrWritten || deb.err == ErrClosed {
+		return err
 	}
+	deb.err = err
 	return err
 }
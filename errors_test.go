@@ -0,0 +1,129 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+// TestValidationError verifies the field of a validation error is reported
+func TestValidationError(t *testing.T) {
+	deb := testValidPkg()
+	defer deb.Close()
+
+	deb.SetMultiArch("yes")
+	err := deb.Write("")
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.Equal(t, "Multi-Arch", verr.Field)
+	assert.EqualError(t, err, `Multi-Arch: unknown Multi-Arch "yes"`)
+}
+
+// TestFileError verifies file errors keep the paths and the cause
+func TestFileError(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	err := deb.AddFile("does-not-exist", "/usr/bin/foo")
+	var ferr *FileError
+	require.True(t, errors.As(err, &ferr))
+	assert.Equal(t, "does-not-exist", ferr.Src)
+	assert.Equal(t, "/usr/bin/foo", ferr.Dest)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.True(t, errors.Is(err, ErrIO))
+	assert.Contains(t, err.Error(), "add file does-not-exist to /usr/bin/foo: ")
+
+	deb = testValidPkg()
+	defer deb.Close()
+
+	f := filepath.Join(test.TempDir(), "does-not-exist", "foo.deb")
+	err = deb.Write(f)
+	require.True(t, errors.As(err, &ferr))
+	assert.Equal(t, "create", ferr.Op)
+	assert.Equal(t, f, ferr.Dest)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	deb = New()
+	defer deb.Close()
+
+	err = deb.AddSymlink("", "/usr/bin/foo")
+	require.True(t, errors.As(err, &ferr))
+	assert.False(t, errors.Is(err, ErrIO))
+}
+
+// TestSpecError verifies specfile problems point to the entry
+func TestSpecError(t *testing.T) {
+	const configFile = `name: foo-errors
+version: 1.0
+# files to add
+files:
+  - content: hello
+    dest: /usr/share/foo/hello
+  -
+    file: does-not-exist
+    dest: /usr/bin/foo
+`
+	filename, err := test.WriteTempFile(t.Name()+".yml", configFile)
+	require.Nil(t, err)
+
+	deb := New()
+	defer deb.Close()
+
+	err = deb.Config(filename)
+	var serr *SpecError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, filename, serr.File)
+	assert.Equal(t, "files[1]", serr.Field)
+	assert.Equal(t, 8, serr.Line)
+	assert.Equal(t, 5, serr.Column)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	var ferr *FileError
+	require.True(t, errors.As(err, &ferr))
+	assert.Equal(t, "does-not-exist", ferr.Src)
+
+	filename, err = test.WriteTempFile(t.Name()+"-flow.yml",
+		"name: foo\nfiles: [{content: hello, dest: /a}, {file: does-not-exist, dest: /b}]\n")
+	require.Nil(t, err)
+
+	deb = New()
+	defer deb.Close()
+
+	err = deb.Config(filename)
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, "files[1]", serr.Field)
+	assert.Equal(t, 2, serr.Line)
+	assert.Equal(t, 37, serr.Column)
+
+	filename, err = test.WriteTempFile(t.Name()+"-custom.yml",
+		"name: foo\ncustom_fields:\n  XB-Foo: bar\n  \"Bad Field\": baz\n")
+	require.Nil(t, err)
+
+	deb = New()
+	defer deb.Close()
+
+	err = deb.Config(filename)
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, "custom_fields[1]", serr.Field)
+	assert.Equal(t, 4, serr.Line)
+	assert.Equal(t, 3, serr.Column)
+
+	filename, err = test.WriteTempFile(t.Name()+"-syntax.yml", "name: foo\nfiles:\n  - file: [\n")
+	require.Nil(t, err)
+
+	deb = New()
+	defer deb.Close()
+
+	err = deb.Config(filename)
+	require.True(t, errors.As(err, &serr))
+	assert.NotZero(t, serr.Line)
+}
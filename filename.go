@@ -0,0 +1,92 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// CanonicalFilenameTemplate generates the canonical Debian filename as expected by archive tools like reprepro,
+// select it with SetFilenameTemplate. E.g: "foo_1.33.7-1_amd64.deb"
+const CanonicalFilenameTemplate = "{{.Package}}_{{.Version}}_{{.Architecture}}.{{.Extension}}"
+
+// FilenameTemplateData holds the values available to a filename template
+type FilenameTemplateData struct {
+	Package      string            // Package name. E.g: "foo"
+	Version      string            // Version without epoch. E.g: "1.33.7-1"
+	FullVersion  string            // Version with epoch. E.g: "1:1.33.7-1"
+	Architecture string            // E.g: "amd64"
+	Extension    string            // File extension by package type: "deb", "udeb" or "ddeb"
+	Fields       map[string]string // All control fields by name. E.g: {{index .Fields "Multi-Arch"}}
+}
+
+// SetFilenameTemplate sets a text/template used by Filename, an empty template restores the GetFilename
+// format. E.g: CanonicalFilenameTemplate or "{{.Package}}_{{.FullVersion}}_{{index .Fields "Multi-Arch"}}.{{.Extension}}"
+func (deb *DebPkg) SetFilenameTemplate(text string) error {
+	if text == "" {
+		deb.filenameTemplate = nil
+		return nil
+	}
+	tmpl, err := template.New("filename").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid filename template: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, FilenameTemplateData{}); err != nil {
+		return fmt.Errorf("invalid filename template: %w", err)
+	}
+	deb.filenameTemplate = tmpl
+	return nil
+}
+
+// Filename renders the template set by SetFilenameTemplate, it is used by Write when no filename is given.
+// It returns GetFilename when no template is set and fails when the template fails or the filename is not
+// a single path element.
+func (deb *DebPkg) Filename() (string, error) {
+	filename := deb.GetFilename()
+	if deb.filenameTemplate != nil {
+		var b bytes.Buffer
+		if err := deb.filenameTemplate.Execute(&b, deb.filenameTemplateData()); err != nil {
+			return "", fmt.Errorf("invalid filename template: %w", err)
+		}
+		filename = b.String()
+	}
+	if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+		return "", fmt.Errorf("invalid filename %q: must not be empty or contain a path separator", filename)
+	}
+	return filename, nil
+}
+
+// filenameTemplateData collects the template values from the control file
+func (deb *DebPkg) filenameTemplateData() FilenameTemplateData {
+	d := FilenameTemplateData{
+		Package:      deb.control.info.name,
+		Version:      deb.control.version(),
+		FullVersion:  deb.control.version(),
+		Architecture: deb.control.info.architecture,
+		Extension:    debianFileExtension,
+		Fields:       make(map[string]string),
+	}
+	if v, err := ParseVersion(d.Version); err == nil {
+		v.Epoch = 0
+		d.Version = v.String()
+	}
+	if deb.control.info.packageType != "" {
+		d.Extension = string(deb.control.info.packageType)
+	}
+
+	var installedSize uint64
+	if deb.data.tgz != nil {
+		installedSize = deb.data.tgz.Written()
+	}
+	for _, line := range strings.Split(deb.control.String(installedSize), "\n") {
+		if i := strings.Index(line, ":"); i > 0 && line[0] != ' ' {
+			d.Fields[line[:i]] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return d
+}
@@ -1,13 +1,16 @@
 module github.com/xor-gate/debpkg
 
-go 1.16
+go 1.22
 
 require (
 	github.com/davecgh/go-spew v1.1.1-0.20170711183451-adab96458c51 // indirect
+	github.com/klauspost/compress v1.18.0
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.1.5-0.20170528135104-b8c9b4ef3dad
+	github.com/ulikunitz/xz v0.5.12
 	github.com/xor-gate/ar v0.0.0-20170530204233-5c72ae81e2b7
 	golang.org/x/crypto v0.0.0-20170808112155-b176d7def5d7
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v2 v2.0.0-20170812160011-eb3733d160e7
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -6,29 +6,52 @@ package config
 
 import (
 	"fmt"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
 )
 
 // PkgSpecFile represents a single debian package
 type PkgSpecFile struct {
-	Name            string `yaml:"name"`
-	Version         string `yaml:"version"`
-	Architecture    string `yaml:"architecture"`
-	Maintainer      string `yaml:"maintainer"`
-	MaintainerEmail string `yaml:"maintainer_email"`
-	Homepage        string `yaml:"homepage"`
-	Section         string `yaml:"section"`
-	Depends         string `yaml:"depends"`
-	Recommends      string `yaml:"recommends"`
-	Suggests        string `yaml:"suggests"`
-	Conflicts       string `yaml:"conflicts"`
-	Provides        string `yaml:"provides"`
-	Replaces        string `yaml:"replaces"`
-	Priority        string `yaml:"priority"`
-	BuiltUsing      string `yaml:"built_using"`
-	Description     struct {
+	Name               string        `yaml:"name"`
+	Version            string        `yaml:"version"`
+	Architecture       string        `yaml:"architecture"`
+	Maintainer         string        `yaml:"maintainer"`
+	MaintainerEmail    string        `yaml:"maintainer_email"`
+	Homepage           string        `yaml:"homepage"`
+	Section            string        `yaml:"section"`
+	Depends            Relations     `yaml:"depends"`
+	Recommends         Relations     `yaml:"recommends"`
+	Suggests           Relations     `yaml:"suggests"`
+	Conflicts          Relations     `yaml:"conflicts"`
+	Provides           Relations     `yaml:"provides"`
+	Replaces           Relations     `yaml:"replaces"`
+	Priority           string        `yaml:"priority"`
+	BuiltUsing         string        `yaml:"built_using"`
+	Compression        string        `yaml:"compression"`
+	CompressionWorkers *int          `yaml:"compression_concurrency"` // Parallel compression workers (0 for all CPUs)
+	PreDepends         Relations     `yaml:"pre_depends"`
+	Breaks             Relations     `yaml:"breaks"`
+	Enhances           Relations     `yaml:"enhances"`
+	StaticBuiltUsing   string        `yaml:"static_built_using"`
+	Essential          bool          `yaml:"essential"`
+	Protected          bool          `yaml:"protected"`
+	MultiArch          string        `yaml:"multi_arch"`
+	Source             string        `yaml:"source"`
+	OriginalMaintainer string        `yaml:"original_maintainer"`
+	RulesRequiresRoot  string        `yaml:"rules_requires_root"`
+	Bugs               string        `yaml:"bugs"`
+	PackageType        string        `yaml:"package_type"` // E.g: "udeb" or "ddeb"
+	BuildIDs           []string      `yaml:"build_ids"`
+	FilenameTemplate   string        `yaml:"filename_template"` // E.g: "{{.Package}}_{{.Version}}_{{.Architecture}}.{{.Extension}}"
+	CustomFields       yaml.MapSlice `yaml:"custom_fields"`     // User defined fields in order. E.g: XB-Foo: bar
+	Changelog          Changelog     `yaml:"changelog"`
+	Copyright          Copyright     `yaml:"copyright"`
+	Description        struct {
 		Short string `yaml:"short"`
 		Long  string `yaml:"long"`
 	}
@@ -37,15 +60,116 @@ type PkgSpecFile struct {
 		Dest       string `yaml:"dest"`
 		Content    string `yaml:"content"`
 		ConfigFile bool   `yaml:"conffile"`
+		Mode       string `yaml:"mode"`  // Octal mode. E.g: "0755" or "4755" for setuid
+		Owner      string `yaml:"owner"` // User name or numeric id
+		Group      string `yaml:"group"` // Group name or numeric id
 	} `yaml:",flow"`
-	Directories      []string `yaml:",flow"`
-	EmptyDirectories []string `yaml:"emptydirs,flow"`
+	Symlinks []struct {
+		Target string `yaml:"target"`
+		Dest   string `yaml:"dest"`
+	} `yaml:",flow"`
+	Directories      []Directory `yaml:",flow"`
+	EmptyDirectories []string    `yaml:"emptydirs,flow"`
 	ControlExtra     struct {
 		Preinst  string `yaml:"preinst"`
 		Postinst string `yaml:"postinst"`
 		Prerm    string `yaml:"prerm"`
 		Postrm   string `yaml:"postrm"`
 	} `yaml:"control_extra"`
+
+	keys map[string]bool // Top level keys set in the specfile
+	root *yaml3.Node     // Top level mapping of the specfile to locate entries, nil when empty
+}
+
+// Relations is a relationship field, either a single string or a list of relations. E.g: ["libc6 (>= 2.31)", "foo | bar"]
+type Relations string
+
+// UnmarshalYAML joins a list of relations with ", "
+func (r *Relations) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*r = Relations(strings.Join(list, ", "))
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	*r = Relations(s)
+	return nil
+}
+
+// Directory maps a host directory into the package, it is either a plain path or a mapping
+type Directory struct {
+	Src            string   `yaml:"src"`
+	Dest           string   `yaml:"dest"`
+	Include        []string `yaml:"include,flow"`
+	Exclude        []string `yaml:"exclude,flow"`
+	IgnoreFile     string   `yaml:"ignore_file"`
+	FollowSymlinks bool     `yaml:"follow_symlinks"`
+}
+
+// UnmarshalYAML accepts a plain path (e.g: "./bin") or a mapping with src, dest and filters
+func (d *Directory) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&d.Src); err == nil {
+		return nil
+	}
+	type plain Directory
+	return unmarshal((*plain)(d))
+}
+
+// Changelog is either the filename of a debian/changelog or a list of entries with the newest first
+type Changelog struct {
+	File    string
+	Entries []ChangelogEntry
+}
+
+// ChangelogEntry is a single release of the changelog
+type ChangelogEntry struct {
+	Version      string   `yaml:"version"`
+	Distribution string   `yaml:"distribution"`
+	Urgency      string   `yaml:"urgency"`
+	Changes      []string `yaml:"changes"`
+	Author       string   `yaml:"author"` // E.g: "Foo Bar <foo@bar.com>"
+	Date         string   `yaml:"date"`   // RFC 2822 date. E.g: "Tue, 01 Aug 2017 12:00:00 +0000"
+}
+
+// UnmarshalYAML accepts a filename (e.g: "debian/changelog") or a list of entries
+func (c *Changelog) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.File); err == nil {
+		return nil
+	}
+	return unmarshal(&c.Entries)
+}
+
+// Copyright is either the filename of a machine-readable debian/copyright or the copyright paragraphs
+type Copyright struct {
+	File            string
+	UpstreamName    string `yaml:"upstream_name"`
+	UpstreamContact string `yaml:"upstream_contact"`
+	Source          string `yaml:"source"`
+	Files           []struct {
+		Files       []string `yaml:"files,flow"`
+		Copyright   []string `yaml:"copyright,flow"`
+		License     string   `yaml:"license"` // SPDX identifier, may be an expression. E.g: "GPL-2+ or MIT"
+		LicenseText string   `yaml:"license_text"`
+		Comment     string   `yaml:"comment"`
+	} `yaml:"files"`
+	Licenses []struct {
+		License  string `yaml:"license"`
+		Text     string `yaml:"text"`
+		TextFile string `yaml:"text_file"` // File with the license text. E.g: "LICENSE"
+		Comment  string `yaml:"comment"`
+	} `yaml:"licenses"`
+}
+
+// UnmarshalYAML accepts a filename (e.g: "debian/copyright") or a mapping with the paragraphs
+func (c *Copyright) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.File); err == nil {
+		return nil
+	}
+	type plain Copyright
+	return unmarshal((*plain)(c))
 }
 
 // PkgSpecFileUnmarshal loads the configuration data into a PkgSpecFile structure
@@ -53,7 +177,6 @@ func PkgSpecFileUnmarshal(data []byte) (*PkgSpecFile, error) {
 	cfg := &PkgSpecFile{
 		Name:            "unknown",
 		Version:         "0.1.0+dev",
-		Architecture:    "any",
 		Maintainer:      "anonymous",
 		MaintainerEmail: "anon@foo.bar",
 		Homepage:        "https://www.google.com",
@@ -66,8 +189,64 @@ func PkgSpecFileUnmarshal(data []byte) (*PkgSpecFile, error) {
 
 	err := yaml.Unmarshal(data, &cfg)
 	if err != nil {
-		return nil, fmt.Errorf("problem unmarshaling config file: %v", err)
+		return nil, fmt.Errorf("problem unmarshaling config file: %w", err)
+	}
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("problem unmarshaling config file: %w", err)
+	}
+	cfg.keys = make(map[string]bool)
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml3.MappingNode {
+		cfg.root = doc.Content[0]
+		for n := 0; n+1 < len(cfg.root.Content); n += 2 {
+			cfg.keys[cfg.root.Content[n].Value] = true
+		}
 	}
 
 	return cfg, nil
 }
+
+// yamlErrorLine matches the line number in a yaml error. E.g: "yaml: line 3: did not find expected key"
+var yamlErrorLine = regexp.MustCompile(`line (\d+):`)
+
+// ErrorLine returns the first line number reported by a yaml error (zero when none)
+func ErrorLine(err error) int {
+	m := yamlErrorLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// Has reports whether the top level key is set in the specfile, as opposed to a default value
+func (cfg *PkgSpecFile) Has(key string) bool {
+	return cfg.keys[key]
+}
+
+// Position returns the line and column of the top level key, or of the index-th entry of the key when the
+// index is not negative. The entry of a mapping is its key, zero is returned when the key is not found and
+// the position of the key when the entry is not found.
+func (cfg *PkgSpecFile) Position(key string, index int) (line, column int) {
+	if cfg.root == nil {
+		return 0, 0
+	}
+	for n := 0; n+1 < len(cfg.root.Content); n += 2 {
+		k, v := cfg.root.Content[n], cfg.root.Content[n+1]
+		if k.Value != key {
+			continue
+		}
+		if v.Kind == yaml3.AliasNode && v.Alias != nil {
+			v = v.Alias
+		}
+		switch {
+		case index < 0:
+		case v.Kind == yaml3.SequenceNode && index < len(v.Content):
+			return v.Content[index].Line, v.Content[index].Column
+		case v.Kind == yaml3.MappingNode && 2*index < len(v.Content):
+			return v.Content[2*index].Line, v.Content[2*index].Column
+		}
+		return k.Line, k.Column
+	}
+	return 0, 0
+}
@@ -0,0 +1,275 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package glob
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match reports whether the slash separated name matches the pattern. The pattern syntax is the
+// same as path.Match with the addition of "**" which matches zero or more path elements.
+func Match(pattern, name string) (bool, error) {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchElems(pattern[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if !ok || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// matchDir reports whether files below the directory name can match the pattern, which stops at the
+// depth of the pattern unless it has a "**" element
+func matchDir(pattern, name []string) (bool, error) {
+	for ; len(name) > 0; pattern, name = pattern[1:], name[1:] {
+		if len(pattern) == 0 {
+			return false, nil
+		}
+		if pattern[0] == "**" {
+			return true, nil
+		}
+		if ok, err := path.Match(pattern[0], name[0]); !ok || err != nil {
+			return false, err
+		}
+	}
+	return len(pattern) > 0, nil
+}
+
+// rule is a single .gitignore-style pattern
+type rule struct {
+	pattern string // Anchored pattern. E.g: "**/*.o"
+	negate  bool   // Pattern started with "!"
+	dirOnly bool   // Pattern ended with "/"
+}
+
+// Ignore is a list of .gitignore-style patterns matched against paths relative to a base directory
+type Ignore struct {
+	rules []rule
+}
+
+// NewIgnore creates an Ignore from patterns, patterns without a "/" match the name at any level
+func NewIgnore(patterns ...string) (*Ignore, error) {
+	ig := &Ignore{}
+	for _, p := range patterns {
+		if err := ig.Add(p); err != nil {
+			return nil, err
+		}
+	}
+	return ig, nil
+}
+
+// ReadIgnoreFile reads a .gitignore-style file, a non-existing file results in no patterns
+func ReadIgnoreFile(filename string) (*Ignore, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return &Ignore{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadIgnore(f)
+}
+
+// ReadIgnore reads .gitignore-style patterns, blank lines and lines starting with "#" are skipped
+func ReadIgnore(r io.Reader) (*Ignore, error) {
+	ig := &Ignore{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := ig.Add(line); err != nil {
+			return nil, err
+		}
+	}
+	return ig, scanner.Err()
+}
+
+// Add adds a single .gitignore-style pattern
+func (ig *Ignore) Add(pattern string) error {
+	var r rule
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, "\\") {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	r.pattern = strings.TrimPrefix(pattern, "/")
+	if _, err := Match(r.pattern, ""); err != nil {
+		return err
+	}
+	ig.rules = append(ig.rules, r)
+	return nil
+}
+
+// Merge appends the patterns of other
+func (ig *Ignore) Merge(other *Ignore) {
+	ig.rules = append(ig.rules, other.rules...)
+}
+
+// Match reports whether the slash separated relative name is ignored, the last matching pattern wins
+func (ig *Ignore) Match(name string, isDir bool) bool {
+	ignored := false
+	for _, r := range ig.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if ok, _ := Match(r.pattern, name); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Len returns the amount of patterns
+func (ig *Ignore) Len() int {
+	return len(ig.rules)
+}
+
+// HasMeta reports whether the pattern contains any of the magic characters recognized by Match, a "[" is
+// only magic when it is closed by a "]". E.g: "foo[1.txt" is a literal name
+func HasMeta(pattern string) bool {
+	if strings.ContainsAny(pattern, "*?") {
+		return true
+	}
+	if i := strings.Index(pattern, "["); i >= 0 {
+		return strings.Contains(pattern[i+1:], "]")
+	}
+	return false
+}
+
+// Base returns the leading elements of the slash separated pattern without magic characters. E.g: "dist" for "dist/**/*.so"
+func Base(pattern string) string {
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if !HasMeta(elem) {
+			continue
+		}
+		base := strings.Join(elems[:i], "/")
+		if base == "" && strings.HasPrefix(pattern, "/") {
+			return "/"
+		} else if base == "" {
+			return "."
+		}
+		return base
+	}
+	return pattern
+}
+
+// Files returns the base directory of the slash separated pattern and the sorted paths relative to it
+// of the regular files matching the pattern. Only directories which can contain a match are read, so
+// the walk stops at the depth of the pattern unless it has a "**" element. Symlinks are followed like
+// AddFile does, a matching dangling symlink or a symlink loop is an error. A non-existing base directory
+// results in no matches.
+func Files(pattern string) (base string, names []string, err error) {
+	pattern = path.Clean(pattern)
+	base = Base(pattern)
+	fi, err := os.Stat(filepath.FromSlash(base))
+	if os.IsNotExist(err) {
+		return base, nil, nil
+	}
+	if err != nil {
+		return base, nil, err
+	}
+	if !fi.IsDir() {
+		return base, nil, nil
+	}
+	err = walk(base, "", pattern, map[string]bool{}, &names)
+	return base, names, err
+}
+
+// canMatch reports whether the name or files below it can match the pattern
+func canMatch(pattern, name string) bool {
+	if ok, _ := Match(pattern, name); ok {
+		return true
+	}
+	ok, _ := matchDir(strings.Split(pattern, "/"), strings.Split(name, "/"))
+	return ok
+}
+
+// walk collects the regular files below dir (relative rel to the base) matching the pattern, the visited
+// directories are resolved to their real path to detect symlink loops
+func walk(dir, rel, pattern string, visited map[string]bool, names *[]string) error {
+	real, err := filepath.EvalSymlinks(filepath.FromSlash(dir))
+	if err != nil {
+		return err
+	}
+	if visited[real] {
+		return fmt.Errorf("symlink loop at %s", dir)
+	}
+	visited[real] = true
+	defer delete(visited, real)
+
+	entries, err := ioutil.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		fi := entry
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if fi, err = os.Stat(filepath.FromSlash(name)); err != nil {
+				if canMatch(pattern, name) {
+					return fmt.Errorf("symlink %s: %w", name, err)
+				}
+				continue
+			}
+		}
+		switch {
+		case fi.IsDir():
+			ok, err := matchDir(strings.Split(pattern, "/"), strings.Split(name, "/"))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := walk(name, path.Join(rel, entry.Name()), pattern, visited, names); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			ok, err := Match(pattern, name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				*names = append(*names, path.Join(rel, entry.Name()))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package targzip
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Supported compression names
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionXz    = "xz"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+)
+
+// compressor creates compressing writers and decompressing readers for a single format
+type compressor struct {
+	ext       string // Archive extension appended to ".tar". E.g: ".gz"
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	// newParallelWriter creates a writer using multiple workers (nil when the format is not parallelized)
+	newParallelWriter func(w io.Writer, workers int) (io.WriteCloser, error)
+}
+
+var compressors = map[string]compressor{
+	CompressionNone: {
+		ext: "",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return nopWriteCloser{w}, nil
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(r), nil
+		},
+	},
+	CompressionGzip: {
+		ext: ".gz",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		newParallelWriter: newParallelGzipWriter,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	CompressionXz: {
+		ext: ".xz",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+		newParallelWriter: newParallelXzWriter,
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(xr), nil
+		},
+	},
+	CompressionZstd: {
+		ext: ".zst",
+		// The encoder defaults to GOMAXPROCS workers, the single-threaded default is explicit
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		},
+		// A zstd stream must be a single frame for dpkg, the encoder compresses the next block while writing
+		newParallelWriter: func(w io.Writer, workers int) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(workers))
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+	CompressionBzip2: {
+		ext: ".bz2",
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// getCompressor looks up a compressor by name which is able to write
+func getCompressor(name string) (compressor, error) {
+	c, ok := compressors[name]
+	if !ok {
+		return c, fmt.Errorf("unsupported compression %q", name)
+	}
+	if c.newWriter == nil {
+		return c, fmt.Errorf("compression %q is read-only", name)
+	}
+	return c, nil
+}
+
+// NewWriter creates a compressing writer by compression name. E.g: "xz"
+func NewWriter(name string, w io.Writer) (io.WriteCloser, error) {
+	c, err := getCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.newWriter(w)
+}
+
+// NewReader creates a decompressing reader based on the archive extension. E.g: ".xz" or ".tar" for none
+func NewReader(ext string, r io.Reader) (io.ReadCloser, error) {
+	if ext == ".tar" {
+		ext = ""
+	}
+	for _, c := range compressors {
+		if c.ext == ext {
+			return c.newReader(r)
+		}
+	}
+	return nil, fmt.Errorf("unsupported compression extension %q", ext)
+}
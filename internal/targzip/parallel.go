@@ -0,0 +1,318 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package targzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Block sizes of the parallel compressors, the output only depends on the block size and not on the amount of workers
+const (
+	gzipBlockSize = 1 << 20 // 1 MiB blocks as deflate only references the previous 32 KiB
+	gzipDictSize  = 32 << 10
+	xzBlockSize   = 4 << 20 // 4 MiB blocks which are also the LZMA2 dictionary size
+)
+
+// errWriterClosed is returned when writing after Close
+var errWriterClosed = errors.New("targzip: compressor is closed")
+
+// compressedBlock is the result of compressing a single block
+type compressedBlock struct {
+	out      []byte // Compressed block
+	size     int    // Uncompressed size
+	unpadded int    // Size without the block padding, used for the xz index
+	err      error
+}
+
+// blockWriter splits the input in blocks which are compressed by concurrent workers and written in order
+type blockWriter struct {
+	w         io.Writer
+	workers   int
+	blockSize int
+	dictSize  int                                                  // Bytes of the previous block passed as dictionary
+	header    []byte                                               // Written before the first block
+	compress  func(block, dict []byte, final bool) compressedBlock // Called concurrently
+	onWrite   func(p []byte)                                       // Called in order for all input (nil when unused)
+	onBlock   func(b compressedBlock)                              // Called in order for each block (nil when unused)
+	trailer   func() []byte                                        // Written after the last block
+
+	buf     []byte
+	dict    []byte
+	pending []chan compressedBlock
+	err     error
+}
+
+// Write buffers p and starts compressing every full block
+func (bw *blockWriter) Write(p []byte) (int, error) {
+	if bw.err != nil {
+		return 0, bw.err
+	}
+	if bw.onWrite != nil {
+		bw.onWrite(p)
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if bw.buf == nil {
+			bw.buf = make([]byte, 0, bw.blockSize)
+		}
+		c := bw.blockSize - len(bw.buf)
+		if c > len(p) {
+			c = len(p)
+		}
+		bw.buf = append(bw.buf, p[:c]...)
+		p = p[c:]
+		if len(bw.buf) == bw.blockSize {
+			if err := bw.dispatch(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// dispatch starts compressing the buffered block, it waits for the oldest block when all workers are busy
+func (bw *blockWriter) dispatch(final bool) error {
+	block, dict := bw.buf, bw.dict
+	bw.buf = nil
+	if bw.dictSize > 0 && len(block) > 0 {
+		start := len(block) - bw.dictSize
+		if start < 0 {
+			start = 0
+		}
+		bw.dict = block[start:]
+	}
+
+	ch := make(chan compressedBlock, 1)
+	go func() {
+		ch <- bw.compress(block, dict, final)
+	}()
+	bw.pending = append(bw.pending, ch)
+
+	for len(bw.pending) >= bw.workers {
+		if err := bw.writeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOldest waits for the oldest pending block and writes it
+func (bw *blockWriter) writeOldest() error {
+	b := <-bw.pending[0]
+	bw.pending = bw.pending[1:]
+	if bw.err != nil {
+		return bw.err
+	}
+	if b.err != nil {
+		bw.err = b.err
+		return bw.err
+	}
+	if bw.header != nil {
+		if _, bw.err = bw.w.Write(bw.header); bw.err != nil {
+			return bw.err
+		}
+		bw.header = nil
+	}
+	if bw.onBlock != nil {
+		bw.onBlock(b)
+	}
+	_, bw.err = bw.w.Write(b.out)
+	return bw.err
+}
+
+// Close compresses the last block, waits for all workers and writes the trailer
+func (bw *blockWriter) Close() error {
+	if bw.err != nil {
+		return bw.err
+	}
+	bw.workers = 1
+	if err := bw.dispatch(true); err != nil {
+		return err
+	}
+	for len(bw.pending) > 0 {
+		if err := bw.writeOldest(); err != nil {
+			return err
+		}
+	}
+	_, bw.err = bw.w.Write(bw.trailer())
+	if bw.err == nil {
+		bw.err = errWriterClosed
+	}
+	return nil
+}
+
+// newParallelGzipWriter creates a single member gzip stream of which the deflate blocks are compressed by
+// concurrent workers. Every block is primed with the last 32 KiB of the previous block and ends on a byte
+// boundary by a sync flush, as done by pigz.
+func newParallelGzipWriter(w io.Writer, workers int) (io.WriteCloser, error) {
+	var crc, size uint32
+	bw := &blockWriter{
+		w:         w,
+		workers:   workers,
+		blockSize: gzipBlockSize,
+		dictSize:  gzipDictSize,
+		// The same header as gzip.Writer: no name, no modification time and unknown OS
+		header: []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255},
+		compress: func(block, dict []byte, final bool) compressedBlock {
+			var buf bytes.Buffer
+			fw, err := flate.NewWriterDict(&buf, flate.DefaultCompression, dict)
+			if err != nil {
+				return compressedBlock{err: err}
+			}
+			if _, err := fw.Write(block); err != nil {
+				return compressedBlock{err: err}
+			}
+			if final {
+				err = fw.Close()
+			} else {
+				err = fw.Flush()
+			}
+			return compressedBlock{out: buf.Bytes(), size: len(block), err: err}
+		},
+		onWrite: func(p []byte) {
+			crc = crc32.Update(crc, crc32.IEEETable, p)
+			size += uint32(len(p))
+		},
+	}
+	bw.trailer = func() []byte {
+		trailer := make([]byte, 8)
+		binary.LittleEndian.PutUint32(trailer[0:4], crc)
+		binary.LittleEndian.PutUint32(trailer[4:8], size)
+		return trailer
+	}
+	return bw, nil
+}
+
+// xz stream constants
+// See: https://tukaani.org/xz/xz-file-format.txt
+var (
+	xzHeaderMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	xzFooterMagic = []byte{'Y', 'Z'}
+	xzStreamFlags = []byte{0x00, 0x04} // CRC64 check
+	xzCRC64Table  = crc64.MakeTable(crc64.ECMA)
+)
+
+const (
+	xzFilterLZMA2 = 0x21
+	xzCheckSize   = 8
+)
+
+// newParallelXzWriter creates a single xz stream with independent blocks which are compressed by concurrent
+// workers, as done by xz --threads
+func newParallelXzWriter(w io.Writer, workers int) (io.WriteCloser, error) {
+	var records []compressedBlock
+
+	header := append(append([]byte{}, xzHeaderMagic...), xzStreamFlags...)
+	header = appendUint32(header, crc32.ChecksumIEEE(xzStreamFlags))
+
+	bw := &blockWriter{
+		w:         w,
+		workers:   workers,
+		blockSize: xzBlockSize,
+		header:    header,
+		compress: func(block, _ []byte, _ bool) compressedBlock {
+			if len(block) == 0 {
+				return compressedBlock{}
+			}
+			return xzCompressBlock(block)
+		},
+		onBlock: func(b compressedBlock) {
+			if b.size > 0 {
+				records = append(records, b)
+			}
+		},
+	}
+	bw.trailer = func() []byte {
+		index := []byte{0x00}
+		index = appendUvarint(index, uint64(len(records)))
+		for _, r := range records {
+			index = appendUvarint(index, uint64(r.unpadded))
+			index = appendUvarint(index, uint64(r.size))
+		}
+		index = appendPadding(index)
+		index = appendUint32(index, crc32.ChecksumIEEE(index))
+
+		footer := appendUint32(nil, uint32(len(index)/4-1))
+		footer = append(footer, xzStreamFlags...)
+		footer = append(appendUint32(nil, crc32.ChecksumIEEE(footer)), footer...)
+		footer = append(footer, xzFooterMagic...)
+		return append(index, footer...)
+	}
+	return bw, nil
+}
+
+// xzCompressBlock compresses a block with LZMA2 and adds the block header, padding and CRC64 check
+func xzCompressBlock(block []byte) compressedBlock {
+	var data bytes.Buffer
+	cfg := lzma.Writer2Config{DictCap: xzBlockSize}
+	lw, err := cfg.NewWriter2(&data)
+	if err != nil {
+		return compressedBlock{err: err}
+	}
+	if _, err := lw.Write(block); err != nil {
+		return compressedBlock{err: err}
+	}
+	if err := lw.Close(); err != nil {
+		return compressedBlock{err: err}
+	}
+
+	// Block header with compressed and uncompressed size and the LZMA2 filter
+	hdr := []byte{0, 0xc0}
+	hdr = appendUvarint(hdr, uint64(data.Len()))
+	hdr = appendUvarint(hdr, uint64(len(block)))
+	hdr = append(hdr, xzFilterLZMA2, 1, xzDictSizeByte(xzBlockSize))
+	for (len(hdr)+4)%4 != 0 {
+		hdr = append(hdr, 0)
+	}
+	hdr[0] = byte((len(hdr)+4)/4 - 1)
+	hdr = appendUint32(hdr, crc32.ChecksumIEEE(hdr))
+
+	out := append(hdr, data.Bytes()...)
+	unpadded := len(out) + xzCheckSize
+	out = appendPadding(out)
+	out = append(out, make([]byte, xzCheckSize)...)
+	binary.LittleEndian.PutUint64(out[len(out)-xzCheckSize:], crc64.Checksum(block, xzCRC64Table))
+	return compressedBlock{out: out, size: len(block), unpadded: unpadded}
+}
+
+// xzDictSizeByte encodes the smallest LZMA2 dictionary size of at least n bytes
+func xzDictSizeByte(n int) byte {
+	for b := byte(0); b < 40; b++ {
+		if (2|uint64(b&1))<<(b/2+11) >= uint64(n) {
+			return b
+		}
+	}
+	return 40
+}
+
+// appendUvarint appends the xz multibyte integer encoding of x
+func appendUvarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+// appendUint32 appends x in little endian
+func appendUint32(b []byte, x uint32) []byte {
+	return append(b, byte(x), byte(x>>8), byte(x>>16), byte(x>>24))
+}
+
+// appendPadding appends zero bytes up to a multiple of four
+func appendPadding(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package targzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+// testCompress writes data in odd sized chunks to the parallel writer and returns the output
+func testCompress(t *testing.T, newWriter func(io.Writer, int) (io.WriteCloser, error), data []byte, workers int) []byte {
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, workers)
+	require.Nil(t, err)
+	for p := data; len(p) > 0; {
+		n := 65521
+		if n > len(p) {
+			n = len(p)
+		}
+		_, err := w.Write(p[:n])
+		require.Nil(t, err)
+		p = p[n:]
+	}
+	require.Nil(t, w.Close())
+
+	_, err = w.Write([]byte("too late"))
+	assert.Equal(t, errWriterClosed, err)
+	return buf.Bytes()
+}
+
+func TestParallelGzipWriter(t *testing.T) {
+	for _, size := range []int{0, gzipBlockSize, 3*gzipBlockSize + 123} {
+		data := test.CompressibleData(size)
+		var first []byte
+		for _, workers := range []int{1, 4} {
+			name := fmt.Sprintf("size %d workers %d", size, workers)
+			out := testCompress(t, newParallelGzipWriter, data, workers)
+
+			r, err := gzip.NewReader(bytes.NewReader(out))
+			require.Nil(t, err, name)
+			r.Multistream(false)
+			b, err := ioutil.ReadAll(r)
+			require.Nil(t, err, name)
+			assert.True(t, bytes.Equal(data, b), name)
+			require.Nil(t, r.Close(), name)
+
+			// The output only depends on the block size
+			if first == nil {
+				first = out
+			}
+			assert.True(t, bytes.Equal(first, out), name)
+		}
+	}
+}
+
+func TestParallelXzWriter(t *testing.T) {
+	for _, size := range []int{0, xzBlockSize, 2*xzBlockSize + 123} {
+		data := test.CompressibleData(size)
+		var first []byte
+		for _, workers := range []int{1, 4} {
+			name := fmt.Sprintf("size %d workers %d", size, workers)
+			out := testCompress(t, newParallelXzWriter, data, workers)
+
+			r, err := xz.ReaderConfig{SingleStream: true}.NewReader(bytes.NewReader(out))
+			require.Nil(t, err, name)
+			b, err := ioutil.ReadAll(r)
+			require.Nil(t, err, name)
+			assert.True(t, bytes.Equal(data, b), name)
+
+			if first == nil {
+				first = out
+			}
+			assert.True(t, bytes.Equal(first, out), name)
+		}
+	}
+}
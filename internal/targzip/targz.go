@@ -6,7 +6,7 @@ package targzip
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,13 +15,48 @@ import (
 	"time"
 )
 
-// TarGzip is a combined writer for .tar.gz-alike files
+// TarGzip is a combined writer for .tar.gz-alike files, the compression defaults to gzip
 type TarGzip struct {
-	wc       io.WriteCloser
-	tw       *tar.Writer
-	gw       *gzip.Writer
-	written  uint64
-	fileName string
+	wc          io.WriteCloser
+	tw          *tar.Writer
+	cw          io.WriteCloser
+	compression string
+	compressor  compressor
+	concurrency int // Compression workers (single-threaded when below 2)
+	modTime     time.Time
+	written     uint64
+	compressed  uint64
+	current     string                                              // Name of the entry being written
+	progress    func(name string, written, compressed uint64) error // Called after each write (nil when unset)
+	fileName    string
+	buf         *bytes.Buffer // In-memory archive (nil when backed by a tempfile)
+	closed      bool          // Set after Close or Remove, the underlying file is closed
+}
+
+// Attr overrides the mode and ownership of an entry, zero values keep the defaults (root:root)
+type Attr struct {
+	Mode  int64  // Permission bits including setuid (04000), setgid (02000) and sticky (01000)
+	Uid   int    // Owner user id
+	Gid   int    // Owner group id
+	Uname string // Owner user name
+	Gname string // Owner group name
+}
+
+// apply sets the mode and ownership on the header
+func (a Attr) apply(hdr *tar.Header) {
+	if a.Mode != 0 {
+		hdr.Mode = hdr.Mode&^07777 | a.Mode&07777
+	}
+	hdr.Uid = a.Uid
+	hdr.Gid = a.Gid
+	hdr.Uname = a.Uname
+	hdr.Gname = a.Gname
+	if hdr.Uname == "" && hdr.Uid == 0 {
+		hdr.Uname = "root"
+	}
+	if hdr.Gname == "" && hdr.Gid == 0 {
+		hdr.Gname = "root"
+	}
 }
 
 // new creates a new targzip writer
@@ -29,12 +64,105 @@ func newWriter(wc io.WriteCloser) *TarGzip {
 	t := &TarGzip{}
 
 	t.wc = wc
-	t.gw = gzip.NewWriter(wc)
-	t.tw = tar.NewWriter(t.gw)
+	t.compression = CompressionGzip
+	t.compressor = compressors[CompressionGzip]
 
 	return t
 }
 
+// SetCompression sets the compression by name. E.g: "xz", it must be called before anything is written
+func (t *TarGzip) SetCompression(name string) error {
+	if t.tw != nil {
+		return fmt.Errorf("cannot change compression after writing")
+	}
+	c, err := getCompressor(name)
+	if err != nil {
+		return err
+	}
+	t.compression = name
+	t.compressor = c
+	return nil
+}
+
+// SetConcurrency sets the amount of workers compressing blocks in parallel, it must be called before anything is
+// written. The parallel stream is standard-compatible but differs from the single-threaded stream.
+func (t *TarGzip) SetConcurrency(workers int) error {
+	if t.tw != nil {
+		return fmt.Errorf("cannot change concurrency after writing")
+	}
+	t.concurrency = workers
+	return nil
+}
+
+// Compression returns the compression name. E.g: "gzip"
+func (t *TarGzip) Compression() string {
+	return t.compression
+}
+
+// Extension returns the archive file extension. E.g: ".tar.gz"
+func (t *TarGzip) Extension() string {
+	return ".tar" + t.compressor.ext
+}
+
+// SetModTime sets a fixed modification time for new entries, the modification time of added
+// files is clamped to it. When unset the current time is used and file times are preserved.
+func (t *TarGzip) SetModTime(mt time.Time) {
+	t.modTime = mt
+}
+
+// now returns the modification time for new entries
+func (t *TarGzip) now() time.Time {
+	if t.modTime.IsZero() {
+		return time.Now()
+	}
+	return t.modTime
+}
+
+// SetProgress sets a function which is called when an entry is started and after each write with the
+// uncompressed and compressed bytes written so far, a returned error aborts the write.
+func (t *TarGzip) SetProgress(fn func(name string, written, compressed uint64) error) {
+	t.progress = fn
+}
+
+// notify calls the progress function
+func (t *TarGzip) notify() error {
+	if t.progress == nil {
+		return nil
+	}
+	return t.progress(t.current, t.written, t.compressed)
+}
+
+// compressedCounter counts the compressed bytes written to the underlying writer
+type compressedCounter struct {
+	t *TarGzip
+}
+
+func (c compressedCounter) Write(p []byte) (int, error) {
+	n, err := c.t.wc.Write(p)
+	c.t.compressed += uint64(n)
+	return n, err
+}
+
+// init lazily creates the tar and compression writers on first use
+func (t *TarGzip) init() error {
+	if t.tw != nil {
+		return nil
+	}
+	newWriter := t.compressor.newWriter
+	if t.concurrency > 1 && t.compressor.newParallelWriter != nil {
+		newWriter = func(w io.Writer) (io.WriteCloser, error) {
+			return t.compressor.newParallelWriter(w, t.concurrency)
+		}
+	}
+	cw, err := newWriter(compressedCounter{t})
+	if err != nil {
+		return err
+	}
+	t.cw = cw
+	t.tw = tar.NewWriter(cw)
+	return nil
+}
+
 // NewTempFile create a new targzip writer tempfile
 func NewTempFile(dir string) (*TarGzip, error) {
 	f, err := ioutil.TempFile(dir, "debpkg")
@@ -47,8 +175,16 @@ func NewTempFile(dir string) (*TarGzip, error) {
 	return t, nil
 }
 
-// AddFile write a file from filename into dest
-func (t *TarGzip) AddFile(filename string, dest ...string) error {
+// NewMemory creates a new targzip writer which keeps the archive in memory
+func NewMemory() *TarGzip {
+	buf := &bytes.Buffer{}
+	t := newWriter(nopWriteCloser{buf})
+	t.buf = buf
+	return t
+}
+
+// AddFile write a file from filename into dest (filename when empty), the host mode is kept unless overridden
+func (t *TarGzip) AddFile(filename, dest string, attr Attr) error {
 	fd, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -66,11 +202,11 @@ func (t *TarGzip) AddFile(filename string, dest ...string) error {
 	// now lets create the header as needed for this file within the tarball
 	hdr, err := tar.FileInfoHeader(stat, filename)
 	if err != nil {
-		return fmt.Errorf("dir tar finfo: %v", err)
+		return fmt.Errorf("dir tar finfo: %w", err)
 	}
 
-	if len(dest) > 0 && len(dest[0]) > 0 {
-		hdr.Name = dest[0]
+	if len(dest) > 0 {
+		hdr.Name = dest
 	} else {
 		hdr.Name = filename
 	}
@@ -80,10 +216,14 @@ func (t *TarGzip) AddFile(filename string, dest ...string) error {
 	}
 
 	hdr.Name = strings.Trim(hdr.Name, "/")
-	hdr.Uid = 0
-	hdr.Gid = 0
-	hdr.Uname = "root"
-	hdr.Gname = "root"
+	attr.apply(hdr)
+	if !t.modTime.IsZero() {
+		if hdr.ModTime.After(t.modTime) {
+			hdr.ModTime = t.modTime
+		}
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+	}
 
 	// write the header to the tarball archive
 	if err := t.writeHeader(hdr); err != nil {
@@ -99,51 +239,94 @@ func (t *TarGzip) AddFile(filename string, dest ...string) error {
 }
 
 // AddFileFromBuffer adds a file from a buffer. The mode is optional and defaults to 0644.
-func (t *TarGzip) AddFileFromBuffer(filename string, b []byte, mode int64) error {
-	if mode == 0 {
-		mode = 0644
-	}
-
+func (t *TarGzip) AddFileFromBuffer(filename string, b []byte, attr Attr) error {
 	hdr := tar.Header{
 		Name:     strings.Trim(filename, "/"),
 		Size:     int64(len(b)),
-		Mode:     mode,
-		Uid:      0,
-		Gid:      0,
-		ModTime:  time.Now(),
+		Mode:     0644,
+		ModTime:  t.now(),
 		Typeflag: tar.TypeReg,
 	}
+	attr.apply(&hdr)
 
 	if err := t.writeHeader(&hdr); err != nil {
-		return fmt.Errorf("cannot write header of file: %v", err)
+		return fmt.Errorf("cannot write header of file: %w", err)
 	}
 
 	if _, err := t.Write(b); err != nil {
-		return fmt.Errorf("cannot write file: %v", err)
+		return fmt.Errorf("cannot write file: %w", err)
 	}
 
 	return nil
 }
 
-// AddDirectory adds a directory entry
-func (t *TarGzip) AddDirectory(dirpath string) error {
+// AddDirectory adds a directory entry, the mode defaults to 0755
+func (t *TarGzip) AddDirectory(dirpath string, attr Attr) error {
 	dirpath = strings.Trim(dirpath, "/")
 	hdr := &tar.Header{
 		Name:     dirpath,
 		Mode:     int64(0755 | 040000),
 		Typeflag: tar.TypeDir,
-		ModTime:  time.Now(),
+		ModTime:  t.now(),
 		Size:     0,
 	}
+	attr.apply(hdr)
+	if err := t.writeHeader(hdr); err != nil {
+		return fmt.Errorf("tar-header for dir: %w", err)
+	}
+	return nil
+}
+
+// AddSymlink adds a symbolic link entry at dest pointing to target
+func (t *TarGzip) AddSymlink(target, dest string) error {
+	if target == "" {
+		return fmt.Errorf("empty symlink target")
+	}
+	hdr := &tar.Header{
+		Name:     strings.Trim(dest, "/"),
+		Linkname: target,
+		Mode:     0777,
+		Typeflag: tar.TypeSymlink,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  t.now(),
+	}
+	if err := t.writeHeader(hdr); err != nil {
+		return fmt.Errorf("tar-header for symlink: %w", err)
+	}
+	return nil
+}
+
+// AddHardlink adds a hard link entry at dest to the already added file target
+func (t *TarGzip) AddHardlink(target, dest string) error {
+	if target == "" {
+		return fmt.Errorf("empty hardlink target")
+	}
+	hdr := &tar.Header{
+		Name:     strings.Trim(dest, "/"),
+		Linkname: strings.Trim(target, "/"),
+		Mode:     0644,
+		Typeflag: tar.TypeLink,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  t.now(),
+	}
 	if err := t.writeHeader(hdr); err != nil {
-		return fmt.Errorf("tar-header for dir: %v", err)
+		return fmt.Errorf("tar-header for hardlink: %w", err)
 	}
 	return nil
 }
 
 // writeHeader writes a raw tar header
 func (t *TarGzip) writeHeader(hdr *tar.Header) error {
-	return t.tw.WriteHeader(hdr)
+	if err := t.init(); err != nil {
+		return err
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	t.current = hdr.Name
+	return t.notify()
 }
 
 // Write writes raw tar data
@@ -151,33 +334,65 @@ func (t *TarGzip) Write(p []byte) (n int, err error) {
 	n, err = t.tw.Write(p)
 	if err == nil {
 		t.written += uint64(n)
+		err = t.notify()
 	}
 	return n, err
 }
 
+// Started reports whether any entry has been written
+func (t *TarGzip) Started() bool {
+	return t.tw != nil
+}
+
 // Written returns the amount of bytes written in uncompressed form
 func (t *TarGzip) Written() uint64 {
 	return t.written
 }
 
-// Close closes the targzip writer
+// Compressed returns the amount of compressed bytes written
+func (t *TarGzip) Compressed() uint64 {
+	return t.compressed
+}
+
+// Close flushes the archive and closes the targzip writer and the underlying file, it is a no-op when closed
 func (t *TarGzip) Close() error {
+	if t.closed {
+		return nil
+	}
+	if err := t.init(); err != nil {
+		return err
+	}
 	if err := t.tw.Close(); err != nil {
 		return err
 	}
-	if err := t.gw.Close(); err != nil {
+	if err := t.cw.Close(); err != nil {
 		return err
 	}
-	return nil
+	t.closed = true
+	if err := t.wc.Close(); err != nil {
+		return err
+	}
+	return t.notify()
 }
 
-// Name returns the name of the file as presented to Open.
+// Name returns the name of the file as presented to Open, it is empty when the archive is in memory.
 func (t *TarGzip) Name() string {
 	return t.fileName
 }
 
+// Open opens the closed archive for reading
+func (t *TarGzip) Open() (io.ReadCloser, error) {
+	if t.buf != nil {
+		return ioutil.NopCloser(bytes.NewReader(t.buf.Bytes())), nil
+	}
+	return os.Open(t.fileName)
+}
+
 // Size returns the length in bytes for the closed file
 func (t *TarGzip) Size() int64 {
+	if t.buf != nil {
+		return int64(t.buf.Len())
+	}
 	fi, err := os.Stat(t.Name())
 	if err != nil {
 		return 0
@@ -185,10 +400,20 @@ func (t *TarGzip) Size() int64 {
 	return fi.Size()
 }
 
-// Remove removes the tempfile
+// Remove removes the tempfile or releases the in-memory archive, an unclosed archive is discarded
 func (t *TarGzip) Remove() error {
+	if !t.closed {
+		t.closed = true
+		t.wc.Close()
+	}
+	if t.buf != nil {
+		t.buf.Reset()
+		return nil
+	}
 	if t.fileName == "" {
 		return nil
 	}
-	return os.Remove(t.fileName)
+	name := t.fileName
+	t.fileName = ""
+	return os.Remove(name)
 }
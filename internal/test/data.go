@@ -0,0 +1,22 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package test
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// CompressibleData generates n bytes of deterministic text-like data which repeats over compression blocks
+func CompressibleData(n int) []byte {
+	words := []string{"debian ", "package ", "archive ", "data ", "control ", "0x1f8b ", "\n"}
+	rnd := rand.New(rand.NewSource(1))
+	var b bytes.Buffer
+	for b.Len() < n {
+		b.WriteString(words[rnd.Intn(len(words))])
+		b.WriteByte(byte(rnd.Intn(256)))
+	}
+	return b.Bytes()[:n]
+}
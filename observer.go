@@ -0,0 +1,78 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"context"
+)
+
+// Stage is the part of the package which is being built
+type Stage string
+
+// Build stages reported to the Observer
+const (
+	StageData    Stage = "data"    // Writing data.tar.*
+	StageControl Stage = "control" // Writing control.tar.*
+	StageAr      Stage = "ar"      // Writing the .deb ar archive
+	StageSign    Stage = "sign"    // Creating the GPG signed digest
+)
+
+// Event reports the progress of a stage. For StageData and StageControl an event is emitted when an archive entry
+// is started and while its content is written. For StageAr an event is emitted for each member of the .deb.
+type Event struct {
+	Stage      Stage  // Stage being built
+	Name       string // Archive entry or member. E.g: "usr/bin/foo" or "data.tar.gz"
+	Written    uint64 // Uncompressed bytes written to the stage archive, for StageAr the bytes of the .deb
+	Compressed uint64 // Compressed bytes of the stage archive (zero for StageAr and StageSign)
+}
+
+// Observer receives the build events, it is called synchronously and should return quickly
+type Observer func(Event)
+
+// SetObserver sets the function receiving the build progress events (nil to disable)
+func (deb *DebPkg) SetObserver(o Observer) {
+	deb.observer = o
+}
+
+// notify sends the event to the observer and reports whether the build context is cancelled
+func (deb *DebPkg) notify(ev Event) error {
+	if deb.observer != nil {
+		deb.observer(ev)
+	}
+	return deb.ctxErr()
+}
+
+// stageProgress returns the archive progress function which notifies events for the stage
+func (deb *DebPkg) stageProgress(stage Stage) func(name string, written, compressed uint64) error {
+	return func(name string, written, compressed uint64) error {
+		return deb.notify(Event{Stage: stage, Name: name, Written: written, Compressed: compressed})
+	}
+}
+
+// withContext runs fn with the context used for cancellation of the build, when fn fails because the
+// context is cancelled the context error is returned
+func (deb *DebPkg) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	prev := deb.ctx
+	deb.ctx = ctx
+	defer func() { deb.ctx = prev }()
+	if err := fn(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+// ctxErr returns the error of the current build context, if any
+func (deb *DebPkg) ctxErr() error {
+	if deb.ctx == nil {
+		return nil
+	}
+	return deb.ctx.Err()
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+// TestObserver verifies the events of all stages are reported
+func TestObserver(t *testing.T) {
+	deb := testNewPkg("debpkg-test-observer", "0.0.1", "all")
+	defer deb.Close()
+
+	var events []Event
+	deb.SetObserver(func(ev Event) {
+		events = append(events, ev)
+	})
+	require.Nil(t, deb.AddFileString("hello", "/usr/share/foo/hello"))
+	require.Nil(t, deb.AddFile("debpkg.go", "/usr/share/foo/debpkg.go"))
+
+	f := test.TempFile(t)
+	require.Nil(t, deb.WriteSigned(f, e))
+
+	names := make(map[Stage][]string)
+	for _, ev := range events {
+		if n := names[ev.Stage]; len(n) == 0 || n[len(n)-1] != ev.Name {
+			names[ev.Stage] = append(n, ev.Name)
+		}
+	}
+	assert.Equal(t, []string{"usr", "usr/share", "usr/share/foo", "usr/share/foo/hello", "usr/share/foo/debpkg.go"}, names[StageData])
+	assert.Contains(t, names[StageControl], "control")
+	assert.Contains(t, names[StageControl], "md5sums")
+	assert.Equal(t, []string{"digests.asc"}, names[StageSign])
+	assert.Equal(t, []string{"debian-binary", "control.tar.gz", "data.tar.gz", "digests.asc"}, names[StageAr])
+
+	fi, err := os.Stat(f)
+	require.Nil(t, err)
+	last := events[len(events)-1]
+	assert.Equal(t, StageAr, last.Stage)
+	assert.Equal(t, uint64(fi.Size()), last.Written)
+	assert.Equal(t, deb.data.tgz.Written(), lastEvent(events, StageData).Written)
+	assert.Equal(t, uint64(deb.data.tgz.Size()), lastEvent(events, StageData).Compressed)
+}
+
+// lastEvent returns the last event of the stage
+func lastEvent(events []Event, stage Stage) Event {
+	var last Event
+	for _, ev := range events {
+		if ev.Stage == stage {
+			last = ev
+		}
+	}
+	return last
+}
+
+// TestWriteContextCanceled verifies a cancelled write fails with the context error and leaves no file
+func TestWriteContextCanceled(t *testing.T) {
+	deb := testNewPkg("debpkg-test-observer", "0.0.1", "all")
+	defer deb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deb.SetObserver(func(ev Event) {
+		if ev.Stage == StageAr {
+			cancel()
+		}
+	})
+	require.Nil(t, deb.AddFileString("hello", "/usr/share/foo/hello"))
+
+	f := test.TempFile(t)
+	assert.Equal(t, context.Canceled, deb.WriteContext(ctx, f))
+	_, err := os.Stat(f)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestAddDirectoryContextCanceled verifies the directory walk stops when the context is cancelled
+func TestAddDirectoryContextCanceled(t *testing.T) {
+	deb := testNewPkg("debpkg-test-observer", "0.0.1", "all")
+	defer deb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var files int
+	deb.SetObserver(func(ev Event) {
+		if ev.Stage == StageData && ev.Written == 0 {
+			files++
+			cancel()
+		}
+	})
+
+	assert.Equal(t, context.Canceled, deb.AddDirectoryContext(ctx, "internal"))
+	assert.Equal(t, 1, files)
+	assert.Equal(t, context.Canceled, deb.AddFileContext(context.Background(), "debpkg.go"))
+}
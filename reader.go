@@ -0,0 +1,274 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/xor-gate/ar"
+	"github.com/xor-gate/debpkg/internal/targzip"
+)
+
+// Reader provides read access to an existing debian package
+type Reader struct {
+	f            *os.File
+	r            io.ReaderAt
+	members      []readerMember
+	debianBinary string
+	controlFile  string
+	control      map[string]string
+	conffiles    []string
+	md5sums      map[string]string
+	extra        map[string]string
+}
+
+// readerMember is the location of a single member in the ar container
+type readerMember struct {
+	name   string
+	offset int64
+	size   int64
+}
+
+// DataIterator iterates over the members of the data archive
+type DataIterator struct {
+	tr *tar.Reader
+	rc io.ReadCloser
+}
+
+// Open opens the debian package by filename for reading
+func Open(filename string) (*Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r, err := OpenReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f = f
+	return r, nil
+}
+
+// OpenReader reads a debian package from r
+func OpenReader(r io.ReaderAt) (*Reader, error) {
+	rd := &Reader{
+		r:       r,
+		extra:   make(map[string]string),
+		md5sums: make(map[string]string),
+	}
+	if err := rd.readMembers(); err != nil {
+		return nil, err
+	}
+	if err := rd.readDebianBinary(); err != nil {
+		return nil, err
+	}
+	if err := rd.readControl(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// Close closes the underlying file when the package was opened with Open
+func (r *Reader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// DebianBinary returns the contents of the debian-binary member. E.g: "2.0\n"
+func (r *Reader) DebianBinary() string {
+	return r.debianBinary
+}
+
+// Control returns the raw control file
+func (r *Reader) Control() string {
+	return r.controlFile
+}
+
+// ControlField returns the value of a control field by case-insensitive name. E.g: "Package"
+// Continuation lines of multiline fields (like the long Description) are kept as-is.
+func (r *Reader) ControlField(name string) string {
+	return r.control[strings.ToLower(name)]
+}
+
+// Conffiles returns the list of files marked as configuration file
+func (r *Reader) Conffiles() []string {
+	return r.conffiles
+}
+
+// MD5Sums returns the md5sums of the data files indexed by path (without leading "/")
+func (r *Reader) MD5Sums() map[string]string {
+	return r.md5sums
+}
+
+// ControlExtra returns the contents of an extra control file. E.g: "preinst", "postrm"
+func (r *Reader) ControlExtra(name string) (string, bool) {
+	s, ok := r.extra[name]
+	return s, ok
+}
+
+// Data returns an iterator over the members of the data archive, the caller must Close it
+func (r *Reader) Data() (*DataIterator, error) {
+	m := r.member("data.tar")
+	if m == nil {
+		return nil, fmt.Errorf("missing data archive")
+	}
+	rc, err := targzip.NewReader(path.Ext(m.name), io.NewSectionReader(r.r, m.offset, m.size))
+	if err != nil {
+		return nil, err
+	}
+	return &DataIterator{tr: tar.NewReader(rc), rc: rc}, nil
+}
+
+// Next advances to the next entry in the data archive, io.EOF is returned at the end
+func (it *DataIterator) Next() (*tar.Header, error) {
+	return it.tr.Next()
+}
+
+// Read reads from the current entry in the data archive
+func (it *DataIterator) Read(p []byte) (int, error) {
+	return it.tr.Read(p)
+}
+
+// Close closes the data archive decompressor
+func (it *DataIterator) Close() error {
+	return it.rc.Close()
+}
+
+// readMembers indexes all members of the ar container
+func (r *Reader) readMembers() error {
+	sr := io.NewSectionReader(r.r, 0, math.MaxInt64)
+	magic := make([]byte, len(ar.GLOBAL_HEADER))
+	if _, err := io.ReadFull(sr, magic); err != nil || string(magic) != ar.GLOBAL_HEADER {
+		return fmt.Errorf("not a debian package: missing ar header")
+	}
+	if _, err := sr.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	rd := ar.NewReader(sr)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read ar header: %w", err)
+		}
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		r.members = append(r.members, readerMember{
+			name:   strings.TrimSuffix(hdr.Name, "/"),
+			offset: offset,
+			size:   hdr.Size,
+		})
+	}
+
+	if len(r.members) == 0 {
+		return fmt.Errorf("not a debian package: empty ar archive")
+	}
+	return nil
+}
+
+// member finds the first ar member starting with prefix
+func (r *Reader) member(prefix string) *readerMember {
+	for i := range r.members {
+		if strings.HasPrefix(r.members[i].name, prefix) {
+			return &r.members[i]
+		}
+	}
+	return nil
+}
+
+func (r *Reader) readDebianBinary() error {
+	if r.members[0].name != "debian-binary" {
+		return fmt.Errorf("not a debian package: first member is %q", r.members[0].name)
+	}
+	b, err := ioutil.ReadAll(io.NewSectionReader(r.r, r.members[0].offset, r.members[0].size))
+	if err != nil {
+		return err
+	}
+	r.debianBinary = string(b)
+	return nil
+}
+
+func (r *Reader) readControl() error {
+	m := r.member("control.tar")
+	if m == nil {
+		return fmt.Errorf("missing control archive")
+	}
+	rc, err := targzip.NewReader(path.Ext(m.name), io.NewSectionReader(r.r, m.offset, m.size))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", m.name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", m.name, err)
+		}
+
+		switch name := path.Clean(hdr.Name); name {
+		case "control":
+			r.controlFile = string(b)
+		case "conffiles":
+			r.conffiles = readerLines(string(b))
+		case "md5sums":
+			for _, line := range readerLines(string(b)) {
+				fields := strings.SplitN(line, "  ", 2)
+				if len(fields) != 2 {
+					return fmt.Errorf("invalid md5sums line: %q", line)
+				}
+				r.md5sums[fields[1]] = fields[0]
+			}
+		default:
+			r.extra[name] = string(b)
+		}
+	}
+
+	if r.controlFile == "" {
+		return fmt.Errorf("missing control file in %s", m.name)
+	}
+	r.control, err = parseControlFields(r.controlFile)
+	return err
+}
+
+// readerLines splits s into non-empty lines
+func readerLines(s string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+)
+
+// TestOpen verifies a written package can be introspected with Open
+func TestOpen(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-open")
+	deb.SetVersion("1.2.3")
+	deb.SetArchitecture("all")
+	deb.SetMaintainer("Foo Bar")
+	deb.SetMaintainerEmail("foo@bar.com")
+	deb.SetShortDescription("some awesome foobar pkg")
+	deb.SetDescription("line one\nline two")
+
+	assert.Nil(t, deb.AddFileString("hello", "/etc/foo/hello.conf"))
+	assert.Nil(t, deb.MarkConfigFile("/etc/foo/hello.conf"))
+	assert.Nil(t, deb.AddControlExtraString("postinst", "#!/bin/sh\necho postinst\n"))
+
+	f := test.TempFile(t)
+	require.Nil(t, deb.Write(f))
+
+	r, err := Open(f)
+	require.Nil(t, err)
+	defer r.Close()
+
+	assert.Equal(t, debianBinaryVersion, r.DebianBinary())
+	assert.Equal(t, "debpkg-test-open", r.ControlField("Package"))
+	assert.Equal(t, "1.2.3", r.ControlField("version"))
+	assert.Equal(t, "Foo Bar <foo@bar.com>", r.ControlField("Maintainer"))
+	assert.Equal(t, "some awesome foobar pkg\n line one\n line two", r.ControlField("Description"))
+	assert.Equal(t, []string{"/etc/foo/hello.conf"}, r.Conffiles())
+	assert.Equal(t, map[string]string{"etc/foo/hello.conf": "5d41402abc4b2a76b9719d911017c592"}, r.MD5Sums())
+
+	postinst, ok := r.ControlExtra("postinst")
+	assert.True(t, ok)
+	assert.Equal(t, "#!/bin/sh\necho postinst\n", postinst)
+	_, ok = r.ControlExtra("prerm")
+	assert.False(t, ok)
+
+	it, err := r.Data()
+	require.Nil(t, err)
+	defer it.Close()
+
+	var names []string
+	for {
+		hdr, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, hdr.Name)
+		if hdr.Name == "etc/foo/hello.conf" {
+			b, err := ioutil.ReadAll(it)
+			assert.Nil(t, err)
+			assert.Equal(t, "hello", string(b))
+		}
+	}
+	assert.Equal(t, []string{"etc", "etc/foo", "etc/foo/hello.conf"}, names)
+}
+
+// TestOpenInvalid verifies non debian packages are rejected
+func TestOpenInvalid(t *testing.T) {
+	_, err := Open("/non/existent/package.deb")
+	assert.NotNil(t, err)
+
+	f, err := test.WriteTempFile(t.Name()+".deb", "this is not an ar archive")
+	require.Nil(t, err)
+	_, err = Open(f)
+	assert.NotNil(t, err)
+
+	fd, err := os.Open("debpkg.go")
+	require.Nil(t, err)
+	defer fd.Close()
+	_, err = OpenReader(fd)
+	assert.NotNil(t, err)
+}
+
+func TestParseControlFields(t *testing.T) {
+	fields, err := parseControlFields("Package: foo\nDescription: short\n long\n .\n")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"package":     "foo",
+		"description": "short\n long\n .",
+	}, fields)
+
+	_, err = parseControlFields(" continuation\n")
+	assert.NotNil(t, err)
+	_, err = parseControlFields("no field name\n")
+	assert.NotNil(t, err)
+}
+
+// TestOpenCompression verifies the archive member names follow the compression and can be read back
+func TestOpenCompression(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionXz, CompressionZstd} {
+		deb := New()
+		deb.SetName("debpkg-test-compression")
+		testSetMaintainer(deb)
+		deb.SetArchitecture("all")
+		require.Nil(t, deb.SetCompression(c))
+		assert.Nil(t, deb.AddFileString("hello", "/foo/bar"))
+
+		f := test.TempDir() + string(os.PathSeparator) + t.Name() + "-" + string(c) + ".deb"
+		require.Nil(t, deb.Write(f))
+		deb.Close()
+		testReadWithNativeDpkg(t, f)
+
+		r, err := Open(f)
+		require.Nil(t, err)
+
+		ext := map[Compression]string{CompressionNone: "", CompressionGzip: ".gz", CompressionXz: ".xz", CompressionZstd: ".zst"}[c]
+		assert.Equal(t, "control.tar"+ext, r.members[1].name)
+		assert.Equal(t, "data.tar"+ext, r.members[2].name)
+		assert.Equal(t, "debpkg-test-compression", r.ControlField("Package"))
+		assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", r.MD5Sums()["foo/bar"])
+		r.Close()
+	}
+}
+
+// TestSetCompressionError verifies unsupported and late compression changes are rejected
+func TestSetCompressionError(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	assert.NotNil(t, deb.SetCompression(CompressionBzip2))
+	assert.NotNil(t, deb.SetCompression("lzma"))
+	assert.Nil(t, deb.AddFileString("hello", "/foo/bar"))
+	assert.NotNil(t, deb.SetCompression(CompressionXz))
+}
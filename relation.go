@@ -0,0 +1,407 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Relation operators
+const (
+	RelationEarlier        = "<<" // Strictly earlier
+	RelationEarlierOrEqual = "<=" // Earlier or equal
+	RelationEqual          = "="  // Exactly equal
+	RelationLaterOrEqual   = ">=" // Later or equal
+	RelationLater          = ">>" // Strictly later
+)
+
+// relationRegexp matches a single relation. E.g: "libc6:amd64 (>= 2.17) [amd64 !i386] <!nocheck>"
+var relationRegexp = regexp.MustCompile(`^([a-z0-9][a-z0-9+.-]+)(?::([a-z0-9-]+))?\s*(?:\(\s*([<=>]+)\s*([^()\s]+)\s*\))?\s*(?:\[([^\[\]]*)\])?\s*((?:<[^<>]*>\s*)*)$`)
+
+// relationTerm matches an architecture or build profile term with optional negation. E.g: "!i386"
+var relationTerm = regexp.MustCompile(`^!?[a-z0-9][a-z0-9.+-]*$`)
+
+// Relation is a single package relation. E.g: "libc6:amd64 (>= 2.31) [amd64] <!nocheck>"
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#syntax-of-relationship-fields
+type Relation struct {
+	Name     string     // Package name. E.g: "libc6"
+	ArchQual string     // Architecture qualifier, empty when omitted. E.g: "any"
+	Operator string     // One of the Relation* operators, empty when unversioned
+	Version  string     // Version, empty when unversioned. E.g: "2.31"
+	Archs    []string   // Architecture restrictions, prefixed with "!" when negated. E.g: []string{"!i386"}
+	Profiles [][]string // Build profile formulas, one list of terms per <...> group. E.g: [][]string{{"!nocheck"}}
+}
+
+// Alternatives is a list of relations of which one must be satisfied. E.g: "foo | bar"
+type Alternatives []Relation
+
+// Relations is a relationship field as comma separated list of alternatives. E.g: "libc6 (>= 2.31), foo | bar"
+type Relations []Alternatives
+
+// ParseRelations parses a relationship field, an empty field results in no relations
+func ParseRelations(s string) (Relations, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var rels Relations
+	for _, group := range strings.Split(s, ",") {
+		var alts Alternatives
+		for _, rel := range strings.Split(group, "|") {
+			r, err := parseRelation(strings.TrimSpace(rel))
+			if err != nil {
+				return nil, err
+			}
+			alts = append(alts, r)
+		}
+		rels = append(rels, alts)
+	}
+	return rels, nil
+}
+
+// parseRelation parses a single relation without alternatives
+func parseRelation(s string) (Relation, error) {
+	if s == "" {
+		return Relation{}, fmt.Errorf("empty relation")
+	}
+	m := relationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Relation{}, fmt.Errorf("malformed relation %q", s)
+	}
+
+	r := Relation{Name: m[1], ArchQual: m[2]}
+	if m[3] != "" {
+		switch m[3] {
+		case RelationEarlier, RelationEarlierOrEqual, RelationEqual, RelationLaterOrEqual, RelationLater:
+		default:
+			return Relation{}, fmt.Errorf("malformed relation %q: unknown operator %q", s, m[3])
+		}
+		if _, err := ParseVersion(m[4]); err != nil {
+			return Relation{}, err
+		}
+		r.Operator, r.Version = m[3], m[4]
+	}
+
+	if strings.Contains(s, "[") {
+		r.Archs = strings.Fields(m[5])
+		if len(r.Archs) == 0 {
+			return Relation{}, fmt.Errorf("malformed relation %q: empty architecture restriction", s)
+		}
+	}
+	for _, arch := range r.Archs {
+		if !relationTerm.MatchString(arch) {
+			return Relation{}, fmt.Errorf("malformed relation %q: malformed architecture %q", s, arch)
+		}
+	}
+
+	for _, profile := range strings.Split(m[6], ">") {
+		profile = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(profile), "<"))
+		if profile == "" {
+			continue
+		}
+		terms := strings.Fields(profile)
+		for _, term := range terms {
+			if !relationTerm.MatchString(term) {
+				return Relation{}, fmt.Errorf("malformed relation %q: malformed build profile %q", s, term)
+			}
+		}
+		r.Profiles = append(r.Profiles, terms)
+	}
+
+	return r, nil
+}
+
+// String formats the relation. E.g: "libc6:amd64 (>= 2.31) [amd64] <!nocheck>"
+func (r Relation) String() string {
+	s := r.Name
+	if r.ArchQual != "" {
+		s += ":" + r.ArchQual
+	}
+	if r.Operator != "" {
+		s += fmt.Sprintf(" (%s %s)", r.Operator, r.Version)
+	}
+	if len(r.Archs) > 0 {
+		s += " [" + strings.Join(r.Archs, " ") + "]"
+	}
+	for _, terms := range r.Profiles {
+		s += " <" + strings.Join(terms, " ") + ">"
+	}
+	return s
+}
+
+// String formats the alternatives separated by " | "
+func (a Alternatives) String() string {
+	s := make([]string, len(a))
+	for i, r := range a {
+		s[i] = r.String()
+	}
+	return strings.Join(s, " | ")
+}
+
+// String formats the relations separated by ", "
+func (rels Relations) String() string {
+	s := make([]string, len(rels))
+	for i, alts := range rels {
+		s[i] = alts.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Merge returns the relations with other appended and duplicates removed. When a single relation on the same
+// package is present twice the unversioned relation is dropped and of two relations with the same operator the
+// stricter is kept. Use MergeBroader for negative relations (Conflicts, Breaks and Replaces).
+func (rels Relations) Merge(other Relations) Relations {
+	return rels.merge(other, false)
+}
+
+// MergeBroader returns the relations with other appended and duplicates removed like Merge, but the relation
+// matching the most versions is kept: the unversioned relation, or of two relations with the same operator the
+// broader. E.g: "foo" and "foo (<< 1.0)" merge into "foo" for Conflicts.
+func (rels Relations) MergeBroader(other Relations) Relations {
+	return rels.merge(other, true)
+}
+
+// merge appends other to the relations and merges single relations on the same package into the stricter
+// or broader one
+func (rels Relations) merge(other Relations, broader bool) Relations {
+	var merged Relations
+	for _, alts := range append(append(Relations{}, rels...), other...) {
+		if len(alts) == 0 {
+			continue
+		}
+		if i := merged.index(alts, broader); i >= 0 {
+			if len(alts) == 1 {
+				if r, ok := mergeRelation(merged[i][0], alts[0], broader); ok {
+					merged[i] = Alternatives{r}
+				}
+			}
+			continue
+		}
+		merged = append(merged, alts)
+	}
+	return merged
+}
+
+// index returns the position of equal alternatives or of a single relation on the same package which can be merged
+func (rels Relations) index(alts Alternatives, broader bool) int {
+	for i, a := range rels {
+		if a.String() == alts.String() {
+			return i
+		}
+		if len(a) == 1 && len(alts) == 1 {
+			if _, ok := mergeRelation(a[0], alts[0], broader); ok {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// mergeRelation merges two relations on the same package (and qualifiers) into the stricter one, or into the
+// broader one matching the most versions
+func mergeRelation(a, b Relation, broader bool) (Relation, bool) {
+	restrictions := func(r Relation) string {
+		return Relation{Archs: r.Archs, Profiles: r.Profiles}.String()
+	}
+	if a.Name != b.Name || a.ArchQual != b.ArchQual || restrictions(a) != restrictions(b) {
+		return Relation{}, false
+	}
+	switch {
+	case a.Operator == b.Operator && a.Version == b.Version:
+		return a, true
+	case b.Operator == "":
+		if broader {
+			return b, true
+		}
+		return a, true
+	case a.Operator == "":
+		if broader {
+			return a, true
+		}
+		return b, true
+	case a.Operator == b.Operator && a.Operator != RelationEqual:
+		cmp, err := CompareVersions(a.Version, b.Version)
+		if err != nil {
+			return Relation{}, false
+		}
+		// The higher version is stricter for ">=" and ">>", the lower for "<=" and "<<"
+		later := a.Operator == RelationLaterOrEqual || a.Operator == RelationLater
+		if (cmp < 0) == (later != broader) {
+			return b, true
+		}
+		return a, true
+	}
+	return Relation{}, false
+}
+
+// addRelations merges rels into the relationship field
+func addRelations(field *string, rels Relations) error {
+	current, err := ParseRelations(*field)
+	if err != nil {
+		return err
+	}
+	*field = current.Merge(rels).String()
+	return nil
+}
+
+// addNegativeRelations merges rels into the negative relationship field, the broader relations are kept
+func addNegativeRelations(field *string, rels Relations) error {
+	current, err := ParseRelations(*field)
+	if err != nil {
+		return err
+	}
+	*field = current.MergeBroader(rels).String()
+	return nil
+}
+
+// newRelations creates relations with a single relation, a version requires an operator
+func newRelations(name, operator, version string) (Relations, error) {
+	if (operator == "") != (version == "") {
+		return nil, fmt.Errorf("relation %s needs both an operator and a version", name)
+	}
+	rel := Relation{Name: name, Operator: operator, Version: version}
+	rels, err := ParseRelations(rel.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(rels) != 1 || len(rels[0]) != 1 {
+		return nil, fmt.Errorf("malformed relation %q", rel.String())
+	}
+	return rels, nil
+}
+
+// AddDepends adds a dependency, operator and version are empty for an unversioned dependency.
+// E.g: AddDepends("libc6", ">=", "2.31")
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#s-binarydeps
+func (deb *DebPkg) AddDepends(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeDepends(rels)
+}
+
+// MergeDepends merges relations into the dependencies, duplicates are removed
+func (deb *DebPkg) MergeDepends(rels Relations) error {
+	return addRelations(&deb.control.info.depends, rels)
+}
+
+// AddRecommends adds a recommendation, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddRecommends(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeRecommends(rels)
+}
+
+// MergeRecommends merges relations into the recommendations, duplicates are removed
+func (deb *DebPkg) MergeRecommends(rels Relations) error {
+	return addRelations(&deb.control.info.recommends, rels)
+}
+
+// AddSuggests adds a suggestion, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddSuggests(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeSuggests(rels)
+}
+
+// MergeSuggests merges relations into the suggestions, duplicates are removed
+func (deb *DebPkg) MergeSuggests(rels Relations) error {
+	return addRelations(&deb.control.info.suggests, rels)
+}
+
+// AddConflicts adds a conflicting package, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddConflicts(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeConflicts(rels)
+}
+
+// MergeConflicts merges relations into the conflicts, duplicates are removed, the broader relation is kept
+func (deb *DebPkg) MergeConflicts(rels Relations) error {
+	return addNegativeRelations(&deb.control.info.conflicts, rels)
+}
+
+// AddProvides adds a provided (virtual) package, the operator must be "=" when a version is given
+func (deb *DebPkg) AddProvides(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeProvides(rels)
+}
+
+// MergeProvides merges relations into the provides, duplicates are removed. Only unversioned and "="
+// relations without alternatives are allowed
+func (deb *DebPkg) MergeProvides(rels Relations) error {
+	if err := validateRelations("Provides", rels.String(), false, true); err != nil {
+		return err
+	}
+	return addRelations(&deb.control.info.provides, rels)
+}
+
+// AddReplaces adds a replaced package, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddReplaces(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeReplaces(rels)
+}
+
+// MergeReplaces merges relations into the replaces, duplicates are removed, the broader relation is kept
+func (deb *DebPkg) MergeReplaces(rels Relations) error {
+	return addNegativeRelations(&deb.control.info.replaces, rels)
+}
+
+// AddPreDepends adds a pre-dependency, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddPreDepends(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergePreDepends(rels)
+}
+
+// MergePreDepends merges relations into the pre-dependencies, duplicates are removed
+func (deb *DebPkg) MergePreDepends(rels Relations) error {
+	return addRelations(&deb.control.info.preDepends, rels)
+}
+
+// AddBreaks adds a broken package, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddBreaks(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeBreaks(rels)
+}
+
+// MergeBreaks merges relations into the breaks, duplicates are removed, the broader relation is kept
+func (deb *DebPkg) MergeBreaks(rels Relations) error {
+	return addNegativeRelations(&deb.control.info.breaks, rels)
+}
+
+// AddEnhances adds an enhanced package, operator and version are empty for an unversioned relation
+func (deb *DebPkg) AddEnhances(name, operator, version string) error {
+	rels, err := newRelations(name, operator, version)
+	if err != nil {
+		return err
+	}
+	return deb.MergeEnhances(rels)
+}
+
+// MergeEnhances merges relations into the enhances, duplicates are removed
+func (deb *DebPkg) MergeEnhances(rels Relations) error {
+	return addRelations(&deb.control.info.enhances, rels)
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRelations(t *testing.T) {
+	rels, err := ParseRelations("libc6:amd64 (>= 2.31) [amd64 !i386] <!nocheck> <stage1 cross>, foo|bar ( << 2.0 )")
+	require.Nil(t, err)
+	assert.Equal(t, Relations{
+		{{Name: "libc6", ArchQual: "amd64", Operator: ">=", Version: "2.31", Archs: []string{"amd64", "!i386"},
+			Profiles: [][]string{{"!nocheck"}, {"stage1", "cross"}}}},
+		{{Name: "foo"}, {Name: "bar", Operator: "<<", Version: "2.0"}},
+	}, rels)
+	assert.Equal(t, "libc6:amd64 (>= 2.31) [amd64 !i386] <!nocheck> <stage1 cross>, foo | bar (<< 2.0)", rels.String())
+
+	rels, err = ParseRelations("")
+	assert.Nil(t, err)
+	assert.Nil(t, rels)
+
+	for _, in := range []string{"foo,", "foo,,bar", "Foo", "foo (> 1.0)", "foo (>= )", "foo (>= a1)", "foo []", "foo [amd64", "foo <!>"} {
+		_, err := ParseRelations(in)
+		assert.NotNil(t, err, in)
+	}
+}
+
+func TestRelationsMerge(t *testing.T) {
+	a, err := ParseRelations("libc6 (>= 2.17), foo | bar, baz, qux (<= 2.0)")
+	require.Nil(t, err)
+	b, err := ParseRelations("libc6 (>= 2.31), foo | bar, baz (>= 1.0), qux (<= 1.0), libc6:i386")
+	require.Nil(t, err)
+
+	assert.Equal(t, "libc6 (>= 2.31), foo | bar, baz (>= 1.0), qux (<= 1.0), libc6:i386", a.Merge(b).String())
+	assert.Equal(t, "libc6 (>= 2.31), foo | bar, baz (>= 1.0), qux (<= 1.0), libc6:i386", b.Merge(a).String())
+
+	c, err := ParseRelations("foo (>= 1.0), foo (<< 2.0)")
+	require.Nil(t, err)
+	assert.Equal(t, "foo (>= 1.0), foo (<< 2.0)", c.Merge(nil).String())
+
+	d, err := ParseRelations("foo (>> 1.0), bar (<< 2.0)")
+	require.Nil(t, err)
+	e, err := ParseRelations("foo (>> 1.5), bar (<< 1.0)")
+	require.Nil(t, err)
+	assert.Equal(t, "foo (>> 1.5), bar (<< 1.0)", d.Merge(e).String())
+}
+
+func TestRelationsMergeBroader(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, merged string
+	}{
+		{"foo", "foo (<< 1.0)", "foo"},
+		{"foo (<< 1.0)", "foo", "foo"},
+		{"foo (<= 1.0)", "foo (<= 2.0)", "foo (<= 2.0)"},
+		{"foo (<< 2.0)", "foo (<< 1.0)", "foo (<< 2.0)"},
+		{"foo (>= 1.0)", "foo (>= 2.0)", "foo (>= 1.0)"},
+		{"foo (>> 2.0)", "foo (>> 1.0)", "foo (>> 1.0)"},
+		{"foo (= 1.0)", "foo (= 2.0)", "foo (= 1.0), foo (= 2.0)"},
+		{"foo (<< 1.0)", "foo (>> 2.0)", "foo (<< 1.0), foo (>> 2.0)"},
+		{"foo (<< 1.0)", "foo:i386 (<< 2.0)", "foo (<< 1.0), foo:i386 (<< 2.0)"},
+	} {
+		a, err := ParseRelations(tc.a)
+		require.Nil(t, err)
+		b, err := ParseRelations(tc.b)
+		require.Nil(t, err)
+		assert.Equal(t, tc.merged, a.MergeBroader(b).String(), tc.a+" + "+tc.b)
+	}
+}
+
+func TestMergeNegativeRelations(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetConflicts("foo")
+	assert.Nil(t, deb.AddConflicts("foo", "<<", "1.0"))
+	assert.Equal(t, "foo", deb.control.info.conflicts)
+
+	assert.Nil(t, deb.AddBreaks("bar", "<=", "1.0"))
+	assert.Nil(t, deb.AddBreaks("bar", "<=", "2.0"))
+	assert.Equal(t, "bar (<= 2.0)", deb.control.info.breaks)
+
+	assert.Nil(t, deb.AddReplaces("baz", "<<", "2.0"))
+	rels, err := ParseRelations("baz (<< 1.0), qux")
+	require.Nil(t, err)
+	assert.Nil(t, deb.MergeReplaces(rels))
+	assert.Equal(t, "baz (<< 2.0), qux", deb.control.info.replaces)
+
+	assert.Nil(t, deb.AddDepends("foo", ">=", "1.0"))
+	assert.Nil(t, deb.AddDepends("foo", "", ""))
+	assert.Equal(t, "foo (>= 1.0)", deb.control.info.depends)
+}
+
+func TestAddDepends(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetDepends("lsb-release")
+	assert.Nil(t, deb.AddDepends("libc6", ">=", "2.17"))
+	assert.Nil(t, deb.AddDepends("libc6", ">=", "2.31"))
+	assert.Nil(t, deb.AddDepends("lsb-release", "", ""))
+	alts, err := ParseRelations("default-mta | mail-transport-agent")
+	require.Nil(t, err)
+	assert.Nil(t, deb.MergeDepends(alts))
+	assert.Nil(t, deb.MergeDepends(alts))
+	assert.Equal(t, "lsb-release, libc6 (>= 2.31), default-mta | mail-transport-agent", deb.control.info.depends)
+
+	assert.NotNil(t, deb.AddDepends("libc6", ">", "2.17"))
+	assert.NotNil(t, deb.AddDepends("libc6", "", "2.17"))
+	assert.NotNil(t, deb.AddDepends("libc6, foo", "", ""))
+
+	assert.Nil(t, deb.AddProvides("editor", "=", "1.0"))
+	assert.NotNil(t, deb.AddProvides("editor", ">=", "1.0"))
+	alts, err = ParseRelations("vim | emacs")
+	require.Nil(t, err)
+	assert.NotNil(t, deb.MergeProvides(alts))
+	assert.Nil(t, deb.AddConflicts("pico", "", ""))
+	assert.Nil(t, deb.AddReplaces("pico", "<<", "2.0"))
+	assert.Nil(t, deb.AddRecommends("nano", "", ""))
+	assert.Nil(t, deb.AddSuggests("curl", "", ""))
+	assert.Equal(t, "editor (= 1.0)", deb.control.info.provides)
+	assert.Equal(t, "pico", deb.control.info.conflicts)
+	assert.Equal(t, "pico (<< 2.0)", deb.control.info.replaces)
+	assert.Equal(t, "nano", deb.control.info.recommends)
+	assert.Equal(t, "curl", deb.control.info.suggests)
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xor-gate/debpkg"
+)
+
+// CacheFile is the location of the package cache relative to the repository root
+const CacheFile = "db/packages.json"
+
+// cacheRef is a package file in the cache
+type cacheRef struct {
+	Filename  string    `json:"filename"`
+	Component string    `json:"component"`
+	SHA256    string    `json:"sha256"`
+	ModTime   time.Time `json:"mtime"`
+}
+
+// cache is the stored state of the repository, the parsed packages are keyed by SHA256 of the file
+type cache struct {
+	Packages []cacheRef          `json:"packages"`
+	Stanzas  map[string]*Package `json:"stanzas"`
+}
+
+// Open opens the repository in the root directory with the packages of the CacheFile stored by the previous
+// Write, packages of which the file is deleted from the pool are dropped. Files added with AddPool or
+// AddPackage are only read when the modification time or size differs from the cache.
+// The repository is empty when there is no cache.
+func Open(root string, release Release) (*Repository, error) {
+	r := New(root, release)
+	r.cached = true
+
+	b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(CacheFile)))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, &debpkg.FileError{Op: "read cache", Src: CacheFile, Err: err}
+	}
+	var c cache
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, &debpkg.FileError{Op: "read cache", Src: CacheFile, Err: err}
+	}
+
+	for _, ref := range c.Packages {
+		p, ok := c.Stanzas[ref.SHA256]
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(ref.Filename))); err != nil {
+			continue
+		}
+		r.stanzas[ref.SHA256] = p
+		r.files[ref.Filename] = ref
+		r.add(p.with(ref.Filename, ref.Component))
+	}
+	return r, nil
+}
+
+// saveCache stores the packages in the CacheFile
+func (r *Repository) saveCache() error {
+	c := cache{
+		Packages: []cacheRef{},
+		Stanzas:  make(map[string]*Package),
+	}
+	for _, p := range r.packages {
+		ref := r.files[p.Filename]
+		ref.Component = p.Component
+		c.Packages = append(c.Packages, ref)
+		c.Stanzas[p.SHA256] = r.stanzas[p.SHA256]
+	}
+	sort.Slice(c.Packages, func(i, j int) bool {
+		if c.Packages[i].Component != c.Packages[j].Component {
+			return c.Packages[i].Component < c.Packages[j].Component
+		}
+		return c.Packages[i].Filename < c.Packages[j].Filename
+	})
+
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(r.root, filepath.FromSlash(CacheFile)), b)
+}
@@ -0,0 +1,348 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xor-gate/debpkg"
+	"github.com/xor-gate/debpkg/internal/targzip"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Release holds the fields of the Release file of the suite
+type Release struct {
+	Origin        string    // E.g: "Debpkg"
+	Label         string    // E.g: "Debpkg nightly"
+	Suite         string    // Archive name. E.g: "stable"
+	Codename      string    // E.g: "bookworm"
+	Version       string    // E.g: "12.1"
+	Description   string    // Single line description of the suite
+	Components    []string  // Defaults to the components of the added packages
+	Architectures []string  // Defaults to the architectures of the added packages
+	Date          time.Time // Defaults to the current time
+	AcquireByHash bool      // Publishes the indices in by-hash directories for atomic client updates
+}
+
+// releaseHashes are the checksums listed in the Release file and used for the by-hash directories
+var releaseHashes = []struct {
+	name string
+	sum  func(b []byte) string
+}{
+	{"MD5Sum", func(b []byte) string { return fmt.Sprintf("%x", md5.Sum(b)) }},
+	{"SHA256", func(b []byte) string { return fmt.Sprintf("%x", sha256.Sum256(b)) }},
+}
+
+// packagesCompressions are the compressions of the Packages index written next to the uncompressed file
+var packagesCompressions = []struct {
+	name string
+	ext  string
+}{
+	{targzip.CompressionGzip, ".gz"},
+	{targzip.CompressionXz, ".xz"},
+}
+
+// indexFile is a file listed in the Release file
+type indexFile struct {
+	path    string // Slash separated path relative to the suite directory. E.g: "main/binary-amd64/Packages"
+	content []byte
+}
+
+// Write writes the Packages indices and the unsigned Release file to dists/<suite>,
+// a signature from a previous WriteSigned is removed. Versions exceeding SetRetain are removed before.
+func (r *Repository) Write() error {
+	return r.write(nil)
+}
+
+// WriteSigned writes the Packages indices and the Release file to dists/<suite>, the Release file is
+// signed with GPG entity as detached Release.gpg and clearsigned InRelease
+func (r *Repository) WriteSigned(entity *openpgp.Entity) error {
+	if entity == nil || entity.PrivateKey == nil {
+		return fmt.Errorf("missing private key to sign the Release file")
+	}
+	return r.write(entity)
+}
+
+// write writes the indices, the Release file and the signatures when entity is not nil
+func (r *Repository) write(entity *openpgp.Entity) error {
+	suite := filepath.Join(r.root, "dists", r.release.Suite)
+	if err := r.prune(); err != nil {
+		return err
+	}
+
+	var files []indexFile
+	for _, component := range r.Components() {
+		for _, arch := range r.Architectures() {
+			var b bytes.Buffer
+			for i, p := range r.indexPackages(component, arch) {
+				if i > 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(p.Stanza())
+			}
+			index, err := compressIndex(path.Join(component, "binary-"+arch, "Packages"), b.Bytes())
+			if err != nil {
+				return err
+			}
+			files = append(files, index...)
+		}
+	}
+	if r.release.AcquireByHash {
+		if err := writeByHash(suite, files); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := writeFile(filepath.Join(suite, filepath.FromSlash(f.path)), f.content); err != nil {
+			return err
+		}
+	}
+
+	date := r.release.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	release := r.releaseFile(date, files)
+	if err := writeFile(filepath.Join(suite, "Release"), release); err != nil {
+		return err
+	}
+
+	if entity == nil {
+		for _, name := range []string{"Release.gpg", "InRelease"} {
+			if err := os.Remove(filepath.Join(suite, name)); err != nil && !os.IsNotExist(err) {
+				return &debpkg.FileError{Op: "remove", Dest: filepath.Join(suite, name), Err: err}
+			}
+		}
+	} else {
+		detached, inline, err := signRelease(entity, date, release)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(suite, "Release.gpg"), detached); err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(suite, "InRelease"), inline); err != nil {
+			return err
+		}
+	}
+
+	if r.cached {
+		return r.saveCache()
+	}
+	return nil
+}
+
+// writeByHash writes the indices to by-hash/<hash>/<checksum> next to them. The files of the indices in the
+// previous Release file are kept for clients which are updating, older files are removed.
+func writeByHash(suite string, files []indexFile) error {
+	keep := make(map[string]bool)
+	if previous, err := ioutil.ReadFile(filepath.Join(suite, "Release")); err == nil {
+		for _, name := range releaseByHashFiles(previous) {
+			keep[name] = true
+		}
+	}
+
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		for _, h := range releaseHashes {
+			name := path.Join(path.Dir(f.path), "by-hash", h.name, h.sum(f.content))
+			keep[name] = true
+			dirs[path.Dir(name)] = true
+			target := filepath.Join(suite, filepath.FromSlash(name))
+			if _, err := os.Stat(target); err == nil {
+				continue
+			}
+			if err := writeFile(target, f.content); err != nil {
+				return err
+			}
+		}
+	}
+
+	for dir := range dirs {
+		entries, err := ioutil.ReadDir(filepath.Join(suite, filepath.FromSlash(dir)))
+		if err != nil {
+			return &debpkg.FileError{Op: "read", Src: dir, Err: err}
+		}
+		for _, fi := range entries {
+			if name := path.Join(dir, fi.Name()); !keep[name] {
+				if err := os.Remove(filepath.Join(suite, filepath.FromSlash(name))); err != nil {
+					return &debpkg.FileError{Op: "remove", Dest: name, Err: err}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// releaseByHashFiles returns the by-hash locations of the files listed in the Release file
+func releaseByHashFiles(release []byte) []string {
+	var names []string
+	var hash string
+	for _, line := range strings.Split(string(release), "\n") {
+		if !strings.HasPrefix(line, " ") {
+			hash = strings.TrimSuffix(line, ":")
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		for _, h := range releaseHashes {
+			if h.name == hash {
+				names = append(names, path.Join(path.Dir(fields[2]), "by-hash", hash, fields[0]))
+			}
+		}
+	}
+	return names
+}
+
+// releaseFile creates the Release file with the checksums of the files
+func (r *Repository) releaseFile(date time.Time, files []indexFile) []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	field("Origin", r.release.Origin)
+	field("Label", r.release.Label)
+	field("Suite", r.release.Suite)
+	field("Codename", r.release.Codename)
+	field("Version", r.release.Version)
+	field("Date", date.UTC().Format(time.RFC1123))
+	field("Architectures", strings.Join(r.Architectures(), " "))
+	field("Components", strings.Join(r.Components(), " "))
+	field("Description", r.release.Description)
+	if r.release.AcquireByHash {
+		field("Acquire-By-Hash", "yes")
+	}
+
+	for _, h := range releaseHashes {
+		b.WriteString(h.name + ":\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, " %s %d %s\n", h.sum(f.content), len(f.content), f.path)
+		}
+	}
+	return b.Bytes()
+}
+
+// compressIndex returns the index file with its compressed variants
+func compressIndex(name string, content []byte) ([]indexFile, error) {
+	files := []indexFile{{path: name, content: content}}
+	for _, c := range packagesCompressions {
+		var b bytes.Buffer
+		w, err := targzip.NewWriter(c.name, &b)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, fmt.Errorf("cannot compress %s%s: %w", name, c.ext, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("cannot compress %s%s: %w", name, c.ext, err)
+		}
+		files = append(files, indexFile{path: name + c.ext, content: b.Bytes()})
+	}
+	return files, nil
+}
+
+// signRelease creates the armored detached signature and the clearsigned Release file
+func signRelease(entity *openpgp.Entity, date time.Time, release []byte) (detached, inline []byte, err error) {
+	cfg := &packet.Config{
+		DefaultHash: crypto.SHA256,
+		Time:        func() time.Time { return date },
+	}
+
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(release), cfg); err != nil {
+		return nil, nil, fmt.Errorf("error while signing Release.gpg: %w", err)
+	}
+
+	var in bytes.Buffer
+	w, err := clearsign.Encode(&in, entity.PrivateKey, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while signing InRelease: %w", err)
+	}
+	if _, err := w.Write(release); err != nil {
+		return nil, nil, fmt.Errorf("error while signing InRelease: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, fmt.Errorf("error while signing InRelease: %w", err)
+	}
+	return sig.Bytes(), in.Bytes(), nil
+}
+
+// copyFile copies the file src to dest through a temporary file like writeFile
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dir := filepath.Dir(dest)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".debpkg")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, in)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// writeFile writes the file through a temporary file in the same directory which is renamed, clients
+// never read a partially written index
+func writeFile(filename string, content []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &debpkg.FileError{Op: "create", Dest: dir, Err: err}
+	}
+	f, err := ioutil.TempFile(dir, ".debpkg")
+	if err != nil {
+		return &debpkg.FileError{Op: "create", Dest: filename, Err: err}
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return &debpkg.FileError{Op: "write", Dest: filename, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,475 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package repo generates the indices of an APT repository from a pool of debian packages.
+//
+// The packages are scanned from directories below the repository root, the Packages indices and the
+// Release file of a single suite are written to dists/<suite>:
+//
+//	r := repo.New("/srv/apt", repo.Release{Suite: "stable", Origin: "Foo"})
+//	r.AddPool("pool/main", "main")
+//	r.WriteSigned(entity)
+package repo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xor-gate/debpkg"
+)
+
+// DefaultComponent is the component of packages added without one
+const DefaultComponent = "main"
+
+// validArchitecture matches a Debian architecture. E.g: "amd64", "all" or "kfreebsd-i386"
+var validArchitecture = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Package is a single debian package in the repository
+type Package struct {
+	Name         string // Package name. E.g: "foo"
+	Version      string // Full version with epoch. E.g: "1:1.2.3-1"
+	Architecture string // E.g: "amd64" or "all"
+	Source       string // Source package name, the package name when the Source field is absent
+	Component    string // Component of the suite. E.g: "main"
+	Filename     string // Slash separated path relative to the repository root. E.g: "pool/main/foo_1.2.3-1_amd64.deb"
+	Size         int64  // Size of the package file in bytes
+	MD5sum       string // Hex encoded md5 checksum of the package file
+	SHA256       string // Hex encoded sha256 checksum of the package file
+	Control      string // Control file of the package
+}
+
+// Stanza returns the Packages index stanza, the control file with the Filename, Size and checksum fields
+func (p *Package) Stanza() string {
+	return fmt.Sprintf("%s\nFilename: %s\nSize: %d\nMD5sum: %s\nSHA256: %s\n",
+		strings.TrimRight(p.Control, "\n"), p.Filename, p.Size, p.MD5sum, p.SHA256)
+}
+
+// with returns a copy of the package at filename in the component
+func (p *Package) with(filename, component string) *Package {
+	cp := *p
+	cp.Filename = filename
+	cp.Component = component
+	return &cp
+}
+
+// Repository is an APT repository with a single suite below a root directory
+type Repository struct {
+	root     string
+	release  Release
+	retain   int  // Older versions kept by Write (all when negative)
+	cached   bool // Opened with Open, Write stores the CacheFile
+	packages []*Package
+	stanzas  map[string]*Package // Parsed packages by SHA256 of the file
+	files    map[string]cacheRef // Last seen modification time and hash of the files by filename
+}
+
+// New creates a repository in the root directory, the Release fields are written to the Release file.
+// The suite defaults to "stable".
+func New(root string, release Release) *Repository {
+	if release.Suite == "" {
+		release.Suite = "stable"
+	}
+	return &Repository{
+		root:    root,
+		release: release,
+		retain:  -1,
+		stanzas: make(map[string]*Package),
+		files:   make(map[string]cacheRef),
+	}
+}
+
+// SetRetain sets the amount of older versions kept next to the newest version of a package per component
+// and architecture, Write removes the other versions from the indices and the pool. All versions are kept
+// when n is negative (default).
+func (r *Repository) SetRetain(n int) {
+	r.retain = n
+}
+
+// AddPool adds all packages (*.deb) below dir recursively to the component, dir is relative to the root
+func (r *Repository) AddPool(dir, component string) error {
+	return filepath.Walk(filepath.Join(r.root, dir), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || filepath.Ext(path) != ".deb" {
+			return nil
+		}
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return err
+		}
+		return r.AddPackage(rel, component)
+	})
+}
+
+// AddPackage reads the package filename (relative to the root) and adds it to the component.
+// A package with the same name, version and architecture in the component is replaced.
+func (r *Repository) AddPackage(filename, component string) error {
+	if component == "" {
+		component = DefaultComponent
+	}
+	if err := validateComponent(component); err != nil {
+		return &debpkg.FileError{Op: "add package", Src: filename, Err: err}
+	}
+	filename = filepath.ToSlash(filepath.Clean(filename))
+	p, err := r.readPackage(filename)
+	if err != nil {
+		return &debpkg.FileError{Op: "add package", Src: filename, Err: err}
+	}
+	r.add(p.with(filename, component))
+	return nil
+}
+
+// Include copies the package filename into the pool layout of the component and adds it. The destination is
+// pool/<component>/<prefix>/<source>/<name>_<version>_<arch>.deb, see PoolPath. Including a package which is
+// already in the pool with the same content only adds it, different content is an error.
+func (r *Repository) Include(filename, component string) error {
+	if component == "" {
+		component = DefaultComponent
+	}
+	p, err := r.loadPackage(filename)
+	if err != nil {
+		return &debpkg.FileError{Op: "include package", Src: filename, Err: err}
+	}
+
+	dest, err := PoolPath(component, p)
+	if err != nil {
+		return &debpkg.FileError{Op: "include package", Src: filename, Err: err}
+	}
+	target := filepath.Join(r.root, filepath.FromSlash(dest))
+	if _, err := os.Stat(target); err == nil {
+		existing, err := r.readPackage(dest)
+		if err != nil {
+			return &debpkg.FileError{Op: "include package", Src: filename, Dest: dest, Err: err}
+		}
+		if existing.SHA256 != p.SHA256 {
+			return &debpkg.FileError{Op: "include package", Src: filename, Dest: dest,
+				Err: fmt.Errorf("a different package exists in the pool")}
+		}
+	} else {
+		if err := copyFile(filename, target); err != nil {
+			return &debpkg.FileError{Op: "include package", Src: filename, Dest: dest, Err: err}
+		}
+		fi, err := os.Stat(target)
+		if err != nil {
+			return &debpkg.FileError{Op: "include package", Src: filename, Dest: dest, Err: err}
+		}
+		r.files[dest] = cacheRef{Filename: dest, SHA256: p.SHA256, ModTime: fi.ModTime()}
+	}
+
+	r.add(p.with(dest, component))
+	return nil
+}
+
+// Remove removes the version of package name from the component (all versions when empty)
+// and deletes the package files from the pool
+func (r *Repository) Remove(component, name, version string) error {
+	var kept, removed []*Package
+	for _, p := range r.packages {
+		if p.Component == component && p.Name == name && (version == "" || p.Version == version) {
+			removed = append(removed, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("package %s %s not found in %s", name, version, component)
+	}
+	r.packages = kept
+	return r.removeFiles(removed)
+}
+
+// add adds the package, a package with the same name, version and architecture in the component is replaced
+func (r *Repository) add(p *Package) {
+	for i, other := range r.packages {
+		if other.Component == p.Component && other.Name == p.Name &&
+			other.Version == p.Version && other.Architecture == p.Architecture {
+			r.packages[i] = p
+			return
+		}
+	}
+	r.packages = append(r.packages, p)
+}
+
+// removeFiles deletes the files of the removed packages from the pool unless still referenced
+func (r *Repository) removeFiles(removed []*Package) error {
+	referenced := make(map[string]bool)
+	for _, p := range r.packages {
+		referenced[p.Filename] = true
+	}
+	for _, p := range removed {
+		if referenced[p.Filename] {
+			continue
+		}
+		referenced[p.Filename] = true
+		delete(r.files, p.Filename)
+		if err := os.Remove(filepath.Join(r.root, filepath.FromSlash(p.Filename))); err != nil && !os.IsNotExist(err) {
+			return &debpkg.FileError{Op: "remove package", Dest: p.Filename, Err: err}
+		}
+	}
+	return nil
+}
+
+// prune removes the versions exceeding the retain policy
+func (r *Repository) prune() error {
+	if r.retain < 0 {
+		return nil
+	}
+	groups := make(map[string][]*Package)
+	for _, p := range r.packages {
+		key := p.Component + "/" + p.Name + "/" + p.Architecture
+		groups[key] = append(groups[key], p)
+	}
+
+	expired := make(map[*Package]bool)
+	for _, pkgs := range groups {
+		if n := len(pkgs) - r.retain - 1; n > 0 {
+			sortPackages(pkgs)
+			for _, p := range pkgs[:n] {
+				expired[p] = true
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	var kept, removed []*Package
+	for _, p := range r.packages {
+		if expired[p] {
+			removed = append(removed, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	r.packages = kept
+	return r.removeFiles(removed)
+}
+
+// Packages returns the packages of the component sorted by name, version and architecture
+func (r *Repository) Packages(component string) []*Package {
+	var pkgs []*Package
+	for _, p := range r.packages {
+		if p.Component == component {
+			pkgs = append(pkgs, p)
+		}
+	}
+	sortPackages(pkgs)
+	return pkgs
+}
+
+// Components returns the components of the Release, when unset the sorted components of the added packages
+func (r *Repository) Components() []string {
+	if len(r.release.Components) > 0 {
+		return r.release.Components
+	}
+	set := make(map[string]bool)
+	for _, p := range r.packages {
+		set[p.Component] = true
+	}
+	if len(set) == 0 {
+		return []string{DefaultComponent}
+	}
+	return sortedKeys(set)
+}
+
+// Architectures returns the architectures of the Release, when unset the sorted architectures of the
+// added packages. Architecture "all" is only listed when there are no other architectures.
+func (r *Repository) Architectures() []string {
+	if len(r.release.Architectures) > 0 {
+		return r.release.Architectures
+	}
+	set := make(map[string]bool)
+	for _, p := range r.packages {
+		if p.Architecture != "all" {
+			set[p.Architecture] = true
+		}
+	}
+	if len(set) == 0 {
+		return []string{"all"}
+	}
+	return sortedKeys(set)
+}
+
+// indexPackages returns the packages of the component in the Packages index of the architecture,
+// packages for architecture "all" are part of each index
+func (r *Repository) indexPackages(component, arch string) []*Package {
+	var pkgs []*Package
+	for _, p := range r.Packages(component) {
+		if p.Architecture == arch || p.Architecture == "all" {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs
+}
+
+// PoolPath returns the location of the package in the Debian pool layout of the component, the directory
+// is named after the source package below its first letter ("lib" and the next letter for libraries).
+// E.g: "pool/main/f/foo/foo_1.2.3-1_amd64.deb" or "pool/main/libf/libfoo/libfoo1_1.0_amd64.deb"
+// The component and the package fields are validated so the path stays inside the pool.
+func PoolPath(component string, p *Package) (string, error) {
+	if err := validateComponent(component); err != nil {
+		return "", err
+	}
+	if err := validatePackage(p); err != nil {
+		return "", err
+	}
+	source := p.Source
+	if source == "" {
+		source = p.Name
+	}
+	prefix := source[:1]
+	if strings.HasPrefix(source, "lib") && len(source) > 3 {
+		prefix = source[:4]
+	}
+	version := p.Version
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	return path.Join("pool", component, prefix, source, p.Name+"_"+version+"_"+p.Architecture+".deb"), nil
+}
+
+// validatePackage checks the package name, source, version and architecture of an untrusted control file,
+// none of them may contain a path separator or ".."
+func validatePackage(p *Package) error {
+	for _, field := range []struct{ name, value string }{
+		{"Package", p.Name}, {"Source", p.Source}, {"Version", p.Version}, {"Architecture", p.Architecture},
+	} {
+		if strings.ContainsAny(field.value, `/\`) || strings.Contains(field.value, "..") {
+			return fmt.Errorf("invalid %s %q: must not contain a path separator or ..", field.name, field.value)
+		}
+	}
+	if err := debpkg.ValidatePackageName(p.Name); err != nil {
+		return err
+	}
+	if p.Source != "" {
+		if err := debpkg.ValidatePackageName(p.Source); err != nil {
+			return fmt.Errorf("invalid Source: %w", err)
+		}
+	}
+	if _, err := debpkg.ParseVersion(p.Version); err != nil {
+		return err
+	}
+	if !validArchitecture.MatchString(p.Architecture) || p.Architecture == "any" {
+		return fmt.Errorf("invalid architecture %q", p.Architecture)
+	}
+	return nil
+}
+
+// validateComponent checks the component is a relative path without "." or ".." elements. E.g: "main"
+func validateComponent(component string) error {
+	if component == "" || strings.Contains(component, "\\") {
+		return fmt.Errorf("invalid component %q", component)
+	}
+	for _, elem := range strings.Split(component, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return fmt.Errorf("invalid component %q", component)
+		}
+	}
+	return nil
+}
+
+// readPackage reads the package filename below the root, the cached package is used when the file is unchanged
+func (r *Repository) readPackage(filename string) (*Package, error) {
+	hostname := filepath.Join(r.root, filepath.FromSlash(filename))
+	fi, err := os.Stat(hostname)
+	if err != nil {
+		return nil, err
+	}
+	if ref, ok := r.files[filename]; ok && ref.ModTime.Equal(fi.ModTime()) {
+		if p, ok := r.stanzas[ref.SHA256]; ok && p.Size == fi.Size() {
+			return p, nil
+		}
+	}
+
+	p, err := r.loadPackage(hostname)
+	if err != nil {
+		return nil, err
+	}
+	r.files[filename] = cacheRef{Filename: filename, SHA256: p.SHA256, ModTime: fi.ModTime()}
+	return p, nil
+}
+
+// loadPackage calculates the checksums of the package file, the control file is only read when the
+// checksum is not cached
+func (r *Repository) loadPackage(hostname string) (*Package, error) {
+	f, err := os.Open(hostname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	md5sum, sha256sum := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5sum, sha256sum), f)
+	if err != nil {
+		return nil, err
+	}
+	hash := fmt.Sprintf("%x", sha256sum.Sum(nil))
+	if p, ok := r.stanzas[hash]; ok {
+		return p, nil
+	}
+
+	rd, err := debpkg.OpenReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	p := &Package{
+		Name:         rd.ControlField("Package"),
+		Version:      rd.ControlField("Version"),
+		Architecture: rd.ControlField("Architecture"),
+		Source:       rd.ControlField("Package"),
+		Size:         size,
+		MD5sum:       fmt.Sprintf("%x", md5sum.Sum(nil)),
+		SHA256:       hash,
+		Control:      rd.Control(),
+	}
+	if p.Name == "" || p.Version == "" || p.Architecture == "" {
+		return nil, fmt.Errorf("missing Package, Version or Architecture control field")
+	}
+	if source := strings.Fields(rd.ControlField("Source")); len(source) > 0 {
+		p.Source = source[0] // Strip the optional "(version)"
+	}
+	if err := validatePackage(p); err != nil {
+		return nil, err
+	}
+	r.stanzas[hash] = p
+	return p, nil
+}
+
+// sortPackages sorts the packages by name, version (dpkg order) and architecture
+func sortPackages(pkgs []*Package) {
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		a, b := pkgs[i], pkgs[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if c, err := debpkg.CompareVersions(a.Version, b.Version); err == nil && c != 0 {
+			return c < 0
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Architecture < b.Architecture
+	})
+}
+
+// sortedKeys returns the sorted keys of the set
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
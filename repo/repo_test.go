@@ -0,0 +1,354 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/ar"
+	"github.com/xor-gate/debpkg"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// testRepo creates a repository root with the packages below pool/main
+func testRepo(t *testing.T, pkgs ...[3]string) string {
+	root, err := ioutil.TempDir("", "debpkg-repo")
+	require.Nil(t, err)
+	pool := filepath.Join(root, "pool", "main")
+	require.Nil(t, os.MkdirAll(pool, 0755))
+
+	for _, p := range pkgs {
+		testBuild(t, pool, p[0], p[1], p[2], "", p[0])
+	}
+	return root
+}
+
+// testBuild writes a package with the content to dir with the canonical filename and returns the filename
+func testBuild(t *testing.T, dir, name, version, arch, source, content string) string {
+	deb := debpkg.New()
+	defer deb.Close()
+	deb.SetName(name)
+	deb.SetVersion(version)
+	deb.SetArchitecture(arch)
+	deb.SetSource(source)
+	deb.SetShortDescription("test package " + name)
+	deb.SetMaintainer("Foo Bar")
+	deb.SetMaintainerEmail("foo@bar.com")
+	require.Nil(t, deb.AddFileString(content, "/usr/share/"+name))
+	require.Nil(t, deb.SetFilenameTemplate(debpkg.CanonicalFilenameTemplate))
+	filename, err := deb.Filename()
+	require.Nil(t, err)
+	filename = filepath.Join(dir, filename)
+	require.Nil(t, deb.Write(filename))
+	return filename
+}
+
+// testEntity creates a new signing identity
+func testEntity(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("Debpkg Authors", "", "debpkg-authors@xor-gate.org", nil)
+	require.Nil(t, err)
+	for _, id := range e.Identities {
+		require.Nil(t, id.SelfSignature.SignUserId(id.UserId.Id, e.PrimaryKey, e.PrivateKey, nil))
+	}
+	return e
+}
+
+func readFile(t *testing.T, filename string) []byte {
+	b, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	return b
+}
+
+func TestWrite(t *testing.T) {
+	root := testRepo(t,
+		[3]string{"foo", "1.0.0", "amd64"},
+		[3]string{"foo", "1:0.9.0", "amd64"},
+		[3]string{"foo", "1.0.0", "arm64"},
+		[3]string{"bar", "2.0.0", "all"})
+	defer os.RemoveAll(root)
+
+	date := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	r := New(root, Release{Origin: "Debpkg", Codename: "nightly", Date: date})
+	require.Nil(t, r.AddPool("pool", ""))
+	assert.Equal(t, []string{"main"}, r.Components())
+	assert.Equal(t, []string{"amd64", "arm64"}, r.Architectures())
+	require.Nil(t, r.Write())
+
+	suite := filepath.Join(root, "dists", "stable")
+	packages := string(readFile(t, filepath.Join(suite, "main", "binary-amd64", "Packages")))
+	stanzas := strings.Split(strings.TrimSpace(packages), "\n\n")
+	require.Len(t, stanzas, 3)
+	assert.Contains(t, stanzas[0], "Package: bar\n")
+	assert.Contains(t, stanzas[1], "Version: 1.0.0\n")
+	assert.Contains(t, stanzas[2], "Version: 1:0.9.0\n")
+
+	deb := readFile(t, filepath.Join(root, "pool", "main", "bar_2.0.0_all.deb"))
+	assert.Contains(t, stanzas[0], "Filename: pool/main/bar_2.0.0_all.deb\n")
+	assert.Contains(t, stanzas[0], fmt.Sprintf("Size: %d\n", len(deb)))
+	assert.Contains(t, stanzas[0], fmt.Sprintf("MD5sum: %x\n", md5.Sum(deb)))
+	assert.Contains(t, stanzas[0], fmt.Sprintf("SHA256: %x", sha256.Sum256(deb)))
+
+	arm64 := string(readFile(t, filepath.Join(suite, "main", "binary-arm64", "Packages")))
+	assert.Equal(t, 2, strings.Count(arm64, "Package: "))
+
+	gz, err := gzip.NewReader(bytes.NewReader(readFile(t, filepath.Join(suite, "main", "binary-amd64", "Packages.gz"))))
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(gz)
+	require.Nil(t, err)
+	assert.Equal(t, packages, string(b))
+
+	release := string(readFile(t, filepath.Join(suite, "Release")))
+	assert.True(t, strings.HasPrefix(release, "Origin: Debpkg\nSuite: stable\nCodename: nightly\n"+
+		"Date: Tue, 01 Aug 2017 12:00:00 UTC\nArchitectures: amd64 arm64\nComponents: main\nMD5Sum:\n"))
+	for _, name := range []string{"Packages", "Packages.gz", "Packages.xz"} {
+		index := readFile(t, filepath.Join(suite, "main", "binary-amd64", name))
+		assert.Contains(t, release, fmt.Sprintf(" %x %d main/binary-amd64/%s\n", md5.Sum(index), len(index), name))
+		assert.Contains(t, release, fmt.Sprintf(" %x %d main/binary-amd64/%s\n", sha256.Sum256(index), len(index), name))
+	}
+
+	_, err = os.Stat(filepath.Join(suite, "InRelease"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWriteSigned(t *testing.T) {
+	root := testRepo(t, [3]string{"foo", "1.0.0", "all"})
+	defer os.RemoveAll(root)
+
+	e := testEntity(t)
+	r := New(root, Release{Suite: "nightly"})
+	require.Nil(t, r.AddPool("pool/main", "main"))
+	assert.Equal(t, []string{"all"}, r.Architectures())
+	require.Nil(t, r.WriteSigned(e))
+
+	suite := filepath.Join(root, "dists", "nightly")
+	release := readFile(t, filepath.Join(suite, "Release"))
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(release),
+		bytes.NewReader(readFile(t, filepath.Join(suite, "Release.gpg"))))
+	require.Nil(t, err)
+	assert.Equal(t, e.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+
+	block, _ := clearsign.Decode(readFile(t, filepath.Join(suite, "InRelease")))
+	require.NotNil(t, block)
+	assert.Equal(t, string(release), string(block.Plaintext))
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{e}, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	assert.Nil(t, err)
+
+	// An unsigned write removes the stale signatures
+	require.Nil(t, r.Write())
+	_, err = os.Stat(filepath.Join(suite, "Release.gpg"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(suite, "InRelease"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NotNil(t, r.WriteSigned(nil))
+}
+
+func TestAddPackageError(t *testing.T) {
+	root := testRepo(t)
+	defer os.RemoveAll(root)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "pool", "main", "broken.deb"), []byte("broken"), 0644))
+
+	r := New(root, Release{})
+	err := r.AddPool("pool", "main")
+	var fe *debpkg.FileError
+	if assert.True(t, errors.As(err, &fe)) {
+		assert.Equal(t, filepath.Join("pool", "main", "broken.deb"), fe.Src)
+	}
+
+	err = r.AddPackage("pool/main/missing.deb", "main")
+	assert.True(t, errors.Is(err, debpkg.ErrIO))
+}
+
+func TestIncremental(t *testing.T) {
+	root, err := ioutil.TempDir("", "debpkg-repo")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	build, err := ioutil.TempDir("", "debpkg-build")
+	require.Nil(t, err)
+	defer os.RemoveAll(build)
+
+	release := Release{Suite: "nightly", AcquireByHash: true}
+	r, err := Open(root, release)
+	require.Nil(t, err)
+	r.SetRetain(1)
+	for _, version := range []string{"1.0.0", "1.1.0", "1:0.1.0"} {
+		require.Nil(t, r.Include(testBuild(t, build, "foo", version, "amd64", "", "foo"), "main"))
+	}
+	lib := testBuild(t, build, "libbar1", "2.0", "amd64", "libbar (1.0)", "bar")
+	require.Nil(t, r.Include(lib, "main"))
+	require.Nil(t, r.Include(lib, "main"))
+	assert.NotNil(t, r.Include(testBuild(t, build, "libbar1", "2.0", "amd64", "libbar", "changed"), "main"))
+	require.Nil(t, r.Write())
+
+	pool := filepath.Join(root, "pool", "main")
+	_, err = os.Stat(filepath.Join(pool, "f", "foo", "foo_1.0.0_amd64.deb"))
+	assert.True(t, os.IsNotExist(err), "expired version must be removed from the pool")
+	for _, name := range []string{"f/foo/foo_1.1.0_amd64.deb", "f/foo/foo_0.1.0_amd64.deb", "libb/libbar/libbar1_2.0_amd64.deb"} {
+		_, err = os.Stat(filepath.Join(pool, filepath.FromSlash(name)))
+		assert.Nil(t, err, name)
+	}
+
+	var versions []string
+	for _, p := range r.Packages("main") {
+		versions = append(versions, p.Name+"="+p.Version)
+	}
+	assert.Equal(t, []string{"foo=1.1.0", "foo=1:0.1.0", "libbar1=2.0"}, versions)
+
+	suite := filepath.Join(root, "dists", "nightly")
+	release1 := string(readFile(t, filepath.Join(suite, "Release")))
+	assert.Contains(t, release1, "\nAcquire-By-Hash: yes\n")
+	packages := readFile(t, filepath.Join(suite, "main", "binary-amd64", "Packages"))
+	byHash := filepath.Join(suite, "main", "binary-amd64", "by-hash")
+	sha := filepath.Join(byHash, "SHA256", fmt.Sprintf("%x", sha256.Sum256(packages)))
+	assert.Equal(t, packages, readFile(t, sha))
+	assert.Equal(t, packages, readFile(t, filepath.Join(byHash, "MD5Sum", fmt.Sprintf("%x", md5.Sum(packages)))))
+
+	// The cache restores the packages, unchanged files are not read again
+	r, err = Open(root, release)
+	require.Nil(t, err)
+	assert.Len(t, r.Packages("main"), 3)
+	libPool := filepath.Join(pool, "libb", "libbar", "libbar1_2.0_amd64.deb")
+	fi, err := os.Stat(libPool)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(libPool, make([]byte, fi.Size()), 0644))
+	require.Nil(t, os.Chtimes(libPool, fi.ModTime(), fi.ModTime()))
+	require.Nil(t, r.AddPool("pool", "main"))
+	assert.Len(t, r.Packages("main"), 3)
+
+	// Removing packages publishes new indices, the by-hash files of the previous Release are kept
+	require.Nil(t, r.Remove("main", "foo", "1.1.0"))
+	require.Nil(t, r.Write())
+	_, err = os.Stat(filepath.Join(pool, "f", "foo", "foo_1.1.0_amd64.deb"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(sha)
+	assert.Nil(t, err)
+
+	require.Nil(t, r.Remove("main", "foo", ""))
+	require.Nil(t, r.Write())
+	_, err = os.Stat(sha)
+	assert.True(t, os.IsNotExist(err), "by-hash files older than the previous Release must be removed")
+	assert.NotContains(t, string(readFile(t, filepath.Join(suite, "main", "binary-amd64", "Packages"))), "Package: foo")
+	assert.NotNil(t, r.Remove("main", "foo", ""))
+
+	r, err = Open(root, release)
+	require.Nil(t, err)
+	assert.Len(t, r.Packages("main"), 1)
+}
+
+// testBuildControl writes a package with the raw control file to dir and returns the filename, the control
+// fields are not validated as by debpkg
+func testBuildControl(t *testing.T, dir, name, control string) string {
+	var controlTar bytes.Buffer
+	gw := gzip.NewWriter(&controlTar)
+	tw := tar.NewWriter(gw)
+	require.Nil(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	_, err := tw.Write([]byte(control))
+	require.Nil(t, err)
+	require.Nil(t, tw.Close())
+	require.Nil(t, gw.Close())
+
+	var dataTar bytes.Buffer
+	gw = gzip.NewWriter(&dataTar)
+	require.Nil(t, tar.NewWriter(gw).Close())
+	require.Nil(t, gw.Close())
+
+	var deb bytes.Buffer
+	w := ar.NewWriter(&deb)
+	require.Nil(t, w.WriteGlobalHeader())
+	for _, m := range []struct {
+		name string
+		body []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", controlTar.Bytes()},
+		{"data.tar.gz", dataTar.Bytes()},
+	} {
+		require.Nil(t, w.WriteHeader(&ar.Header{Name: m.name, Size: int64(len(m.body)), Mode: 0644, ModTime: time.Now()}))
+		_, err := w.Write(m.body)
+		require.Nil(t, err)
+	}
+	filename := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(filename, deb.Bytes(), 0644))
+	return filename
+}
+
+func TestIncludeMalicious(t *testing.T) {
+	root, err := ioutil.TempDir("", "debpkg-repo")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	build, err := ioutil.TempDir("", "debpkg-build")
+	require.Nil(t, err)
+	defer os.RemoveAll(build)
+
+	r := New(filepath.Join(root, "repo"), Release{})
+	valid := testBuildControl(t, build, "valid.deb", "Package: foo\nVersion: 1.0\nArchitecture: amd64\n")
+	require.Nil(t, r.Include(valid, "main"))
+	assert.NotNil(t, r.Include(valid, "../main"))
+	assert.NotNil(t, r.Include(valid, "/main"))
+	assert.NotNil(t, r.AddPackage("pool/main/f/foo/foo_1.0_amd64.deb", "main/.."))
+
+	for i, control := range []string{
+		"Package: ../../x\nVersion: 1.0\nArchitecture: amd64\n",
+		"Package: foo\nSource: ../../../x\nVersion: 1.0\nArchitecture: amd64\n",
+		"Package: foo\nVersion: 1.0/../../../x\nArchitecture: amd64\n",
+		"Package: foo\nVersion: 1.0\nArchitecture: ../../../../x\n",
+		"Package: foo\nVersion: 1.0\nArchitecture: any\n",
+		"Package: Foo\nVersion: 1.0\nArchitecture: amd64\n",
+		"Package: foo\nVersion: foo\nArchitecture: amd64\n",
+	} {
+		filename := testBuildControl(t, build, fmt.Sprintf("malicious-%d.deb", i), control)
+		err := r.Include(filename, "main")
+		var fe *debpkg.FileError
+		if assert.True(t, errors.As(err, &fe), control) {
+			assert.Equal(t, filename, fe.Src)
+		}
+	}
+
+	// Nothing is written outside the pool of the repository
+	files, err := ioutil.ReadDir(root)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "repo", files[0].Name())
+	assert.Len(t, r.Packages("main"), 1)
+}
+
+func TestPoolPath(t *testing.T) {
+	for _, tc := range []struct {
+		component string
+		p         Package
+		path      string
+	}{
+		{"main", Package{Name: "foo", Version: "1:1.2.3-1", Architecture: "amd64"}, "pool/main/f/foo/foo_1.2.3-1_amd64.deb"},
+		{"contrib", Package{Name: "libfoo1", Source: "libfoo", Version: "1.0", Architecture: "all"},
+			"pool/contrib/libf/libfoo/libfoo1_1.0_all.deb"},
+		{"main", Package{Name: "lib", Version: "1.0", Architecture: "all"}, "pool/main/l/lib/lib_1.0_all.deb"},
+		{"main", Package{Version: "1.0", Architecture: "all"}, ""},
+		{"main", Package{Name: "foo", Source: "..", Version: "1.0", Architecture: "all"}, ""},
+		{"main", Package{Name: "foo", Architecture: "all"}, ""},
+		{"main", Package{Name: "foo", Version: "1.0"}, ""},
+		{"", Package{Name: "foo", Version: "1.0", Architecture: "all"}, ""},
+		{"..", Package{Name: "foo", Version: "1.0", Architecture: "all"}, ""},
+	} {
+		path, err := PoolPath(tc.component, &tc.p)
+		assert.Equal(t, tc.path, path)
+		assert.Equal(t, tc.path == "", err != nil, "%+v", tc.p)
+	}
+}
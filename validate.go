@@ -0,0 +1,297 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// validPackageName matches the package name syntax
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-source
+var validPackageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+// validArchitectures are the architectures known by dpkg-architecture -L for linux and the wildcard all,
+// the wildcard any is only valid for source packages
+// See: https://www.debian.org/ports/
+var validArchitectures = map[string]bool{
+	"all": true, "alpha": true, "amd64": true, "arc": true, "arm": true, "arm64": true, "armel": true, "armhf": true,
+	"hppa": true, "i386": true, "ia64": true, "loong64": true, "m68k": true, "mips": true, "mips64": true,
+	"mips64el": true, "mipsel": true, "powerpc": true, "ppc64": true, "ppc64el": true, "riscv64": true,
+	"s390": true, "s390x": true, "sh4": true, "sparc": true, "sparc64": true, "x32": true,
+	"hurd-i386": true, "hurd-amd64": true, "kfreebsd-amd64": true, "kfreebsd-i386": true,
+}
+
+// validSections are the sections of the Debian archive, optionally prefixed by the archive area. E.g: "contrib/net"
+// See: https://www.debian.org/doc/debian-policy/ch-archive.html#s-subsections
+var validSections = map[string]bool{
+	"admin": true, "cli-mono": true, "comm": true, "database": true, "debug": true, "devel": true,
+	"doc": true, "editors": true, "education": true, "electronics": true, "embedded": true, "fonts": true,
+	"games": true, "gnome": true, "gnu-r": true, "gnustep": true, "graphics": true, "hamradio": true,
+	"haskell": true, "httpd": true, "interpreters": true, "introspection": true, "java": true,
+	"javascript": true, "kde": true, "kernel": true, "libdevel": true, "libs": true, "lisp": true,
+	"localization": true, "mail": true, "math": true, "metapackages": true, "misc": true, "net": true,
+	"news": true, "ocaml": true, "oldlibs": true, "otherosfs": true, "perl": true, "php": true,
+	"python": true, "ruby": true, "rust": true, "science": true, "shells": true, "sound": true,
+	"tasks": true, "tex": true, "text": true, "utils": true, "vcs": true, "video": true, "web": true,
+	"x11": true, "xfce": true, "zope": true,
+}
+
+// validAreas are the archive areas which may prefix a section
+var validAreas = map[string]bool{
+	"main": true, "contrib": true, "non-free": true, "non-free-firmware": true,
+}
+
+// maxSynopsisLength is the recommended maximum length of the single line description
+const maxSynopsisLength = 80
+
+// Validate checks the control fields against the Debian policy and returns all problems found as *ValidationError.
+// It is called by Write which fails with the first problem which is not a warning.
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html
+func (deb *DebPkg) Validate() []error {
+	return deb.control.validate()
+}
+
+// validate the control file for validity, the problems are a *ValidationError
+func (c *control) validate() []error {
+	var errs []error
+	add := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: field, Err: err})
+		}
+	}
+
+	add("Package", validatePackageName(c.info.name))
+	add("Architecture", validateArchitecture(c.info.architecture))
+	if _, err := ParseVersion(c.version()); err != nil {
+		add("Version", err)
+	}
+	add("Maintainer", validateMaintainer(c.info.maintainer, c.info.maintainerEmail))
+	add("Section", validateSection(c.info.section))
+	add("Priority", validatePriority(c.info.priority))
+	add("Pre-Depends", validateRelations("Pre-Depends", c.info.preDepends, true, false))
+	add("Depends", validateRelations("Depends", c.info.depends, true, false))
+	add("Recommends", validateRelations("Recommends", c.info.recommends, true, false))
+	add("Suggests", validateRelations("Suggests", c.info.suggests, true, false))
+	add("Conflicts", validateRelations("Conflicts", c.info.conflicts, false, false))
+	add("Provides", validateRelations("Provides", c.info.provides, false, true))
+	add("Replaces", validateRelations("Replaces", c.info.replaces, false, false))
+	add("Enhances", validateRelations("Enhances", c.info.enhances, false, false))
+	add("Breaks", validateRelations("Breaks", c.info.breaks, false, false))
+	add("Built-Using", validateRelations("Built-Using", c.info.builtUsing, false, true))
+	add("Static-Built-Using", validateRelations("Static-Built-Using", c.info.staticBuiltUsing, false, true))
+	add("Multi-Arch", validateMultiArch(c.info.multiArch))
+	add("Source", validateSource(c.info.source))
+	add("Original-Maintainer", validateOriginalMaintainer(c.info.originalMaintainer))
+	add("Rules-Requires-Root", validateRulesRequiresRoot(c.info.rulesRequiresRoot))
+	add("Package-Type", validatePackageType(c.info.packageType))
+	add("Build-Ids", validateBuildIDs(c.info.buildIDs))
+	for _, err := range validateDescription(c.info.descrShort, c.info.descr) {
+		add("Description", err)
+	}
+	if utf8.RuneCountInString(c.info.descrShort) > maxSynopsisLength {
+		errs = append(errs, &ValidationError{Field: "Description", Warning: true,
+			Err: fmt.Errorf("short description is longer than %d characters", maxSynopsisLength)})
+	}
+
+	return errs
+}
+
+// ValidatePackageName checks the package name consists of at least two lowercase alphanumerics and + - .
+// starting with an alphanumeric. E.g: "libfoo1"
+func ValidatePackageName(name string) error {
+	return validatePackageName(name)
+}
+
+// validatePackageName checks the package name consists of at least two lowercase alphanumerics and + - .
+func validatePackageName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty package name")
+	}
+	if !validPackageName.MatchString(name) {
+		return fmt.Errorf("invalid package name %q: must be at least two characters of [a-z0-9+.-] starting with an alphanumeric", name)
+	}
+	return nil
+}
+
+// validateArchitecture checks the architecture is known and valid for a binary package
+func validateArchitecture(arch string) error {
+	if arch == "" {
+		return fmt.Errorf("empty architecture")
+	}
+	if arch == "any" {
+		return fmt.Errorf("architecture \"any\" is only valid for source packages, use \"all\" or a CPU architecture")
+	}
+	if !validArchitectures[arch] {
+		return fmt.Errorf("unknown architecture %q", arch)
+	}
+	return nil
+}
+
+// validateMaintainer checks the maintainer forms a RFC822 address "Name <email>"
+func validateMaintainer(name, email string) error {
+	if name == "" && email == "" {
+		return fmt.Errorf("empty maintainer")
+	}
+	if name == "" {
+		return fmt.Errorf("empty maintainer name")
+	}
+	if strings.ContainsAny(name, ",<>") {
+		return fmt.Errorf("invalid maintainer name %q: must not contain , < or >", name)
+	}
+	maintainer := fmt.Sprintf("%s <%s>", name, email)
+	addr, err := mail.ParseAddress(maintainer)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("invalid maintainer %q: not a RFC822 address", maintainer)
+	}
+	return nil
+}
+
+// validateSection checks the section is known, an empty section is skipped
+func validateSection(section string) error {
+	if section == "" {
+		return nil
+	}
+	s := section
+	if i := strings.Index(s, "/"); i >= 0 {
+		if !validAreas[s[:i]] {
+			return fmt.Errorf("unknown archive area in section %q", section)
+		}
+		s = s[i+1:]
+	}
+	if !validSections[s] {
+		return fmt.Errorf("unknown section %q", section)
+	}
+	return nil
+}
+
+// validatePriority checks the priority is one of the Priority* constants
+func validatePriority(priority Priority) error {
+	switch priority {
+	case PriorityUnset, PriorityRequired, PriorityImportant, PriorityStandard, PriorityOptional:
+		return nil
+	}
+	return fmt.Errorf("unknown priority %q", priority)
+}
+
+// validateMultiArch checks the multiarch value is one of the MultiArch* constants
+func validateMultiArch(multiArch MultiArch) error {
+	switch multiArch {
+	case MultiArchUnset, MultiArchNo, MultiArchSame, MultiArchForeign, MultiArchAllowed:
+		return nil
+	}
+	return fmt.Errorf("unknown Multi-Arch %q", multiArch)
+}
+
+// validateSource checks the source is a package name with an optional version. E.g: "foo (1.2-1)"
+func validateSource(source string) error {
+	if source == "" {
+		return nil
+	}
+	name, version := source, ""
+	if i := strings.Index(source, " ("); i > 0 && strings.HasSuffix(source, ")") {
+		name, version = source[:i], source[i+2:len(source)-1]
+	}
+	if !validPackageName.MatchString(name) {
+		return fmt.Errorf("invalid Source %q: malformed package name", source)
+	}
+	if version != "" {
+		if _, err := ParseVersion(version); err != nil {
+			return fmt.Errorf("invalid Source %q: %w", source, err)
+		}
+	}
+	return nil
+}
+
+// validateOriginalMaintainer checks the original maintainer is a RFC822 address "Name <email>"
+func validateOriginalMaintainer(maintainer string) error {
+	if maintainer == "" {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(maintainer); err != nil || addr.Name == "" {
+		return fmt.Errorf("invalid Original-Maintainer %q: not a RFC822 address", maintainer)
+	}
+	return nil
+}
+
+// validateRulesRequiresRoot checks the value is "no", "binary-targets" or a list of keywords containing a "/"
+func validateRulesRequiresRoot(rrr string) error {
+	if rrr == "" || rrr == "no" || rrr == "binary-targets" {
+		return nil
+	}
+	for _, keyword := range strings.Fields(rrr) {
+		if !strings.Contains(keyword, "/") {
+			return fmt.Errorf("invalid Rules-Requires-Root %q: keyword %q must contain a \"/\"", rrr, keyword)
+		}
+	}
+	return nil
+}
+
+// validatePackageType checks the package type is one of the PackageType* constants
+func validatePackageType(packageType PackageType) error {
+	switch packageType {
+	case "", PackageTypeDeb, PackageTypeUdeb, PackageTypeDdeb:
+		return nil
+	}
+	return fmt.Errorf("unknown Package-Type %q", packageType)
+}
+
+// validateBuildIDs checks the build-ids are lowercase hex
+func validateBuildIDs(buildIDs []string) error {
+	for _, id := range buildIDs {
+		if _, err := hex.DecodeString(id); err != nil || id == "" || strings.ToLower(id) != id {
+			return fmt.Errorf("invalid Build-Ids: %q is not a lowercase hex string", id)
+		}
+	}
+	return nil
+}
+
+// validateRelations checks the grammar of a relationship field. E.g: "libc6 (>= 2.17), foo | bar".
+// Alternatives are only allowed in Depends, Recommends and Suggests and some fields only allow "=" relations.
+// See: https://www.debian.org/doc/debian-policy/ch-relationships.html#syntax-of-relationship-fields
+func validateRelations(field, value string, alternatives, onlyEqual bool) error {
+	rels, err := ParseRelations(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	for _, alts := range rels {
+		if len(alts) > 1 && !alternatives {
+			return fmt.Errorf("invalid %s %q: alternatives are not allowed", field, value)
+		}
+		for _, rel := range alts {
+			if onlyEqual && rel.Operator != "" && rel.Operator != RelationEqual {
+				return fmt.Errorf("invalid %s %q: only \"=\" relations are allowed", field, value)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDescription checks the synopsis is a single line and the extended description has no empty lines
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Description
+func validateDescription(synopsis, descr string) []error {
+	var errs []error
+	if strings.TrimSpace(synopsis) == "" {
+		errs = append(errs, fmt.Errorf("empty short description"))
+	}
+	if strings.ContainsAny(synopsis, "\r\n") {
+		errs = append(errs, fmt.Errorf("invalid short description: must be a single line"))
+	}
+
+	lines := strings.Split(descr, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			errs = append(errs, fmt.Errorf("invalid description: line %d is empty, use \".\" for a blank line", n+1))
+		}
+	}
+	return errs
+}
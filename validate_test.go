@@ -0,0 +1,111 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testValidPkg creates a package which passes the validation
+func testValidPkg() *DebPkg {
+	deb := testNewPkg("foo", "1:1.2.3~rc1-1ubuntu1", "amd64")
+	deb.SetSection("contrib/net")
+	deb.SetPriority(PriorityOptional)
+	deb.SetDepends("libc6:amd64 (>= 2.17) [amd64 !i386], foo | bar (<< 2.0)")
+	deb.SetProvides("editor (= 1.0)")
+	deb.SetBuiltUsing("gcc-4.6 (= 4.6.0-11)")
+	deb.SetShortDescription("Foo tool")
+	deb.SetDescription("Foo does bar\n.\nAnd baz")
+	return deb
+}
+
+func TestValidate(t *testing.T) {
+	deb := testValidPkg()
+	defer deb.Close()
+	assert.Empty(t, deb.Validate())
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		set func(deb *DebPkg)
+		err string
+	}{
+		{func(deb *DebPkg) { deb.SetName("") }, "empty package name"},
+		{func(deb *DebPkg) { deb.SetName("Foo") }, `invalid package name "Foo"`},
+		{func(deb *DebPkg) { deb.SetName("f") }, `invalid package name "f"`},
+		{func(deb *DebPkg) { deb.SetArchitecture("x86_64") }, `unknown architecture "x86_64"`},
+		{func(deb *DebPkg) { deb.SetArchitecture("any") }, "only valid for source packages"},
+		{func(deb *DebPkg) { deb.SetVersion("v1.0") }, `upstream version "v1.0" must start with a digit`},
+		{func(deb *DebPkg) { deb.SetVersion("a:1.0") }, `epoch "a" must be an unsigned integer`},
+		{func(deb *DebPkg) { deb.SetVersion("1.0-") }, "empty debian revision"},
+		{func(deb *DebPkg) { deb.SetVersion("1.0-1_2") }, `debian revision "1_2"`},
+		{func(deb *DebPkg) { deb.SetVersion("1.0_beta") }, `upstream version "1.0_beta"`},
+		{func(deb *DebPkg) { deb.SetMaintainerEmail("foo") }, "not a RFC822 address"},
+		{func(deb *DebPkg) { deb.SetMaintainer("Bar, Foo") }, `invalid maintainer name "Bar, Foo"`},
+		{func(deb *DebPkg) { deb.SetMaintainer("") }, "empty maintainer name"},
+		{func(deb *DebPkg) { deb.SetMaintainer(""); deb.SetMaintainerEmail("") }, "empty maintainer"},
+		{func(deb *DebPkg) { deb.SetSection("foo") }, `unknown section "foo"`},
+		{func(deb *DebPkg) { deb.SetSection("bar/net") }, "unknown archive area"},
+		{func(deb *DebPkg) { deb.SetPriority("extra") }, `unknown priority "extra"`},
+		{func(deb *DebPkg) { deb.SetDepends("foo,") }, "empty relation"},
+		{func(deb *DebPkg) { deb.SetDepends("foo (> 1.0)") }, `malformed relation "foo (> 1.0)"`},
+		{func(deb *DebPkg) { deb.SetDepends("foo (>= v1)") }, "must start with a digit"},
+		{func(deb *DebPkg) { deb.SetDepends("foo [amd64") }, "malformed relation"},
+		{func(deb *DebPkg) { deb.SetConflicts("foo | bar") }, "alternatives are not allowed"},
+		{func(deb *DebPkg) { deb.SetProvides("foo (>= 1.0)") }, `only "=" relations are allowed`},
+		{func(deb *DebPkg) { deb.SetShortDescription("") }, "empty short description"},
+		{func(deb *DebPkg) { deb.SetShortDescription(" ") }, "empty short description"},
+		{func(deb *DebPkg) { deb.SetShortDescription("foo\nbar") }, "must be a single line"},
+		{func(deb *DebPkg) { deb.SetShortDescription(strings.Repeat("x", 81)) }, "is longer than 80 characters"},
+		{func(deb *DebPkg) { deb.SetDescription("foo\n\nbar") }, "line 2 is empty"},
+		{func(deb *DebPkg) { deb.SetPreDepends("dpkg (>= a)") }, "invalid Pre-Depends"},
+		{func(deb *DebPkg) { deb.SetBreaks("foo | bar") }, "alternatives are not allowed"},
+		{func(deb *DebPkg) { deb.SetEnhances("foo,") }, "invalid Enhances"},
+		{func(deb *DebPkg) { deb.SetStaticBuiltUsing("foo (>= 1.0)") }, `only "=" relations are allowed`},
+		{func(deb *DebPkg) { deb.SetMultiArch("yes") }, `unknown Multi-Arch "yes"`},
+		{func(deb *DebPkg) { deb.SetSource("Foo") }, "malformed package name"},
+		{func(deb *DebPkg) { deb.SetSource("foo (a1)") }, "must start with a digit"},
+		{func(deb *DebPkg) { deb.SetOriginalMaintainer("foo@bar.com") }, "invalid Original-Maintainer"},
+		{func(deb *DebPkg) { deb.SetRulesRequiresRoot("yes") }, "invalid Rules-Requires-Root"},
+	}
+
+	for _, test := range tests {
+		deb := testValidPkg()
+		test.set(deb)
+		errs := deb.Validate()
+		if assert.Len(t, errs, 1, test.err) {
+			assert.Contains(t, errs[0].Error(), test.err)
+		}
+		deb.Close()
+	}
+}
+
+func TestWriteValidate(t *testing.T) {
+	deb := testValidPkg()
+	defer deb.Close()
+
+	deb.SetVersion("v1.0")
+	assert.EqualError(t, deb.Write(""), `Version: invalid version "v1.0": upstream version "v1.0" must start with a digit`)
+}
+
+// TestWriteValidateWarning verifies a warning is reported by Validate but does not fail Write
+func TestWriteValidateWarning(t *testing.T) {
+	deb := testValidPkg()
+	defer deb.Close()
+
+	deb.SetShortDescription(strings.Repeat("x", 81))
+	errs := deb.Validate()
+	require.Len(t, errs, 1)
+	var verr *ValidationError
+	require.True(t, errors.As(errs[0], &verr))
+	assert.True(t, verr.Warning)
+	assert.Equal(t, "Description", verr.Field)
+	assert.Nil(t, testWrite(t, deb))
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// Signature holds the verified signature information of a signed package
+type Signature struct {
+	Signer string          // Signer as noted in the digest. E.g: "Foo Bar <foo@bar.com>"
+	Date   time.Time       // Date of signing as noted in the digest
+	Role   string          // Role of the signer. E.g: "builder"
+	Entity *openpgp.Entity // Key from the keyring which made the signature
+}
+
+// digestFile is a single member entry of the digest
+type digestFile struct {
+	size int64
+	sums map[crypto.Hash]string // Hex encoded checksum by hash
+}
+
+// Verify verifies the signature of a package by filename against the keyring.
+// See: Reader.Verify
+func Verify(filename string, keyring openpgp.KeyRing) (*Signature, error) {
+	r, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return r.Verify(keyring)
+}
+
+// Verify verifies the digests.asc signature against the keyring and recomputes the checksums of all members.
+// ErrUnsigned is returned when the package has no signature. All members of the package must be present in
+// the digest with a matching size and md5, sha1 and (when present) sha256 or sha512 checksum.
+func (r *Reader) Verify(keyring openpgp.KeyRing) (*Signature, error) {
+	m := r.member("digests.asc")
+	if m == nil {
+		return nil, ErrUnsigned
+	}
+	b, err := ioutil.ReadAll(io.NewSectionReader(r.r, m.offset, m.size))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := clearsign.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("digests.asc: no clearsigned message")
+	}
+	entity, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		return nil, fmt.Errorf("digests.asc: invalid signature: %w", err)
+	}
+
+	fields, err := parseControlFields(string(block.Plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("digests.asc: %w", err)
+	}
+	if fields["version"] != strconv.Itoa(digestVersion) {
+		return nil, fmt.Errorf("digests.asc: unsupported version %q", fields["version"])
+	}
+	date, err := time.Parse(time.ANSIC, fields["date"])
+	if err != nil {
+		return nil, fmt.Errorf("digests.asc: invalid date %q", fields["date"])
+	}
+
+	files, err := parseDigestFiles(fields)
+	if err != nil {
+		return nil, fmt.Errorf("digests.asc: %w", err)
+	}
+	for _, member := range r.members {
+		if member.name == "digests.asc" {
+			continue
+		}
+		if err := r.verifyMember(member, files[member.name]); err != nil {
+			return nil, err
+		}
+		delete(files, member.name)
+	}
+	for name := range files {
+		return nil, fmt.Errorf("digests.asc: missing member %s", name)
+	}
+
+	return &Signature{
+		Signer: fields["signer"],
+		Date:   date,
+		Role:   fields["role"],
+		Entity: entity,
+	}, nil
+}
+
+// verifyMember recomputes the checksums of a single ar member and compares them with the digest
+func (r *Reader) verifyMember(m readerMember, f *digestFile) error {
+	if f == nil {
+		return fmt.Errorf("%s: not present in digest", m.name)
+	}
+	if f.size != m.size {
+		return fmt.Errorf("%s: size mismatch", m.name)
+	}
+
+	hashes := make(map[crypto.Hash]hash.Hash)
+	writers := make([]io.Writer, 0, len(f.sums))
+	for h := range f.sums {
+		hashes[h] = h.New()
+		writers = append(writers, hashes[h])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(r.r, m.offset, m.size)); err != nil {
+		return err
+	}
+	for h, sum := range f.sums {
+		if fmt.Sprintf("%x", hashes[h].Sum(nil)) != sum {
+			return fmt.Errorf("%s: %s checksum mismatch", m.name, digestHashName(h))
+		}
+	}
+	return nil
+}
+
+// parseDigestFiles parses the "Files" and "Checksums-*" sections of the digest
+func parseDigestFiles(fields map[string]string) (map[string]*digestFile, error) {
+	files := make(map[string]*digestFile)
+
+	for _, line := range readerLines(fields["files"]) {
+		cols := strings.Fields(line)
+		if len(cols) != 4 {
+			return nil, fmt.Errorf("invalid files line: %q", line)
+		}
+		size, err := strconv.ParseInt(cols[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid files line: %q", line)
+		}
+		files[cols[3]] = &digestFile{
+			size: size,
+			sums: map[crypto.Hash]string{crypto.MD5: cols[0], crypto.SHA1: cols[1]},
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files")
+	}
+
+	for h, field := range digestChecksumsFields {
+		for _, line := range readerLines(fields[strings.ToLower(field)]) {
+			cols := strings.Fields(line)
+			if len(cols) != 3 {
+				return nil, fmt.Errorf("invalid %s line: %q", field, line)
+			}
+			f, ok := files[cols[2]]
+			if !ok || strconv.FormatInt(f.size, 10) != cols[1] {
+				return nil, fmt.Errorf("%s: %s does not match files", field, cols[2])
+			}
+			f.sums[h] = cols[0]
+		}
+	}
+
+	return files, nil
+}
+
+// digestHashName returns the lowercase name of the hash. E.g: "sha256"
+func digestHashName(h crypto.Hash) string {
+	if h == crypto.MD5 {
+		return "md5"
+	}
+	return digestHashes[h]
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xor-gate/debpkg/internal/test"
+	"golang.org/x/crypto/openpgp"
+)
+
+// testWriteSigned writes a minimal signed package with the hash policy
+func testWriteSigned(t *testing.T, filename string, h crypto.Hash) {
+	deb := testNewPkg("debpkg-test-verify", "0.0.1", "all")
+	defer deb.Close()
+
+	require.Nil(t, deb.SetHash(h))
+	require.Nil(t, deb.AddFileString("hello", "/foo/bar"))
+	require.Nil(t, deb.WriteSigned(filename, e))
+}
+
+func TestVerify(t *testing.T) {
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA512} {
+		f := test.TempFile(t)
+		testWriteSigned(t, f, h)
+
+		sig, err := Verify(f, openpgp.EntityList{e})
+		require.Nil(t, err, "hash %v", h)
+		assert.Equal(t, "Debpkg Authors <debpkg-authors@xor-gate.org>", sig.Signer)
+		assert.Equal(t, digestRole, sig.Role)
+		assert.False(t, sig.Date.IsZero())
+		assert.Equal(t, e.PrimaryKey.KeyId, sig.Entity.PrimaryKey.KeyId)
+	}
+}
+
+func TestWriteSignedTo(t *testing.T) {
+	deb := NewInMemory()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-verify")
+	testSetMaintainer(deb)
+	deb.SetVersion("0.0.1")
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.AddFileString("hello", "/foo/bar"))
+
+	var buf bytes.Buffer
+	n, err := deb.WriteSignedTo(&buf, e)
+	require.Nil(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	r, err := OpenReader(bytes.NewReader(buf.Bytes()))
+	require.Nil(t, err)
+	defer r.Close()
+
+	sig, err := r.Verify(openpgp.EntityList{e})
+	require.Nil(t, err)
+	assert.Equal(t, "Debpkg Authors <debpkg-authors@xor-gate.org>", sig.Signer)
+}
+
+// TestWriteVariants verifies a package is written unsigned and signed to multiple destinations
+func TestWriteVariants(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-variants")
+	testSetMaintainer(deb)
+	deb.SetVersion("0.0.1")
+	deb.SetArchitecture("all")
+	require.Nil(t, deb.SetBuildTime(time.Unix(1500000000, 0)))
+	require.Nil(t, deb.AddFileString("hello", "/foo/bar"))
+
+	unsigned := filepath.Join(test.TempDir(), t.Name()+"-unsigned.deb")
+	signed := filepath.Join(test.TempDir(), t.Name()+"-signed.deb")
+	require.Nil(t, deb.Write(unsigned))
+	require.Nil(t, deb.WriteSigned(signed, e))
+	var buf bytes.Buffer
+	_, err := deb.WriteTo(&buf)
+	require.Nil(t, err)
+
+	b, err := ioutil.ReadFile(unsigned)
+	require.Nil(t, err)
+	assert.Equal(t, b, buf.Bytes())
+
+	_, err = Verify(unsigned, openpgp.EntityList{e})
+	assert.Equal(t, ErrUnsigned, err)
+	sig, err := Verify(signed, openpgp.EntityList{e})
+	require.Nil(t, err)
+	assert.Equal(t, "Debpkg Authors <debpkg-authors@xor-gate.org>", sig.Signer)
+
+	testReadWithNativeDpkg(t, unsigned)
+	testReadWithNativeDpkg(t, signed)
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("debpkg-test-verify-unsigned")
+	testSetMaintainer(deb)
+	deb.SetArchitecture("all")
+
+	f := test.TempFile(t)
+	require.Nil(t, deb.Write(f))
+
+	_, err := Verify(f, openpgp.EntityList{e})
+	assert.Equal(t, ErrUnsigned, err)
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	f := test.TempFile(t)
+	testWriteSigned(t, f, crypto.SHA256)
+
+	_, err := Verify(f, openpgp.EntityList{})
+	assert.NotNil(t, err)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	f := test.TempFile(t)
+	testWriteSigned(t, f, crypto.SHA256)
+
+	r, err := Open(f)
+	require.Nil(t, err)
+	data := *r.member("data.tar")
+	r.Close()
+
+	b, err := ioutil.ReadFile(f)
+	require.Nil(t, err)
+	b[data.offset+data.size-1] ^= 0xff
+	require.Nil(t, ioutil.WriteFile(f, b, 0644))
+
+	_, err = Verify(f, openpgp.EntityList{e})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a Debian package version in the form [epoch:]upstream_version[-debian_revision]
+// See: https://www.debian.org/doc/debian-policy/ch-controlfields.html#s-f-Version
+type Version struct {
+	Epoch    uint   // Epoch, zero when omitted
+	Upstream string // Upstream version. E.g: "1.2.3~rc1"
+	Revision string // Debian revision, empty when omitted. E.g: "1ubuntu1"
+}
+
+// ParseVersion parses and validates a version string. E.g: "1:2.30-1"
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	invalid := func(format string, args ...interface{}) (Version, error) {
+		return Version{}, fmt.Errorf("invalid version %q: %s", s, fmt.Sprintf(format, args...))
+	}
+
+	if s == "" {
+		return invalid("empty version")
+	}
+
+	upstream := s
+	if i := strings.Index(upstream, ":"); i >= 0 {
+		epoch, err := strconv.ParseUint(upstream[:i], 10, 32)
+		if err != nil || strings.Trim(upstream[:i], "0123456789") != "" {
+			return invalid("epoch %q must be an unsigned integer", upstream[:i])
+		}
+		v.Epoch = uint(epoch)
+		upstream = upstream[i+1:]
+	}
+
+	if i := strings.LastIndex(upstream, "-"); i >= 0 {
+		v.Revision = upstream[i+1:]
+		if v.Revision == "" {
+			return invalid("empty debian revision")
+		}
+		if !isVersionString(v.Revision, "+.~") {
+			return invalid("debian revision %q may only contain [A-Za-z0-9+.~]", v.Revision)
+		}
+		upstream = upstream[:i]
+	}
+
+	if upstream == "" {
+		return invalid("empty upstream version")
+	}
+	if upstream[0] < '0' || upstream[0] > '9' {
+		return invalid("upstream version %q must start with a digit", upstream)
+	}
+	if !isVersionString(upstream, ".+~-:") {
+		return invalid("upstream version %q may only contain [A-Za-z0-9.+~-:]", upstream)
+	}
+	v.Upstream = upstream
+
+	return v, nil
+}
+
+// isVersionString reports whether s only consists of ASCII alphanumerics and the extra characters
+func isVersionString(s, extra string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune(extra, r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the canonical form, the epoch and revision are omitted when empty. E.g: "1:2.30-1"
+func (v Version) String() string {
+	s := v.Upstream
+	if v.Epoch > 0 {
+		s = fmt.Sprintf("%d:%s", v.Epoch, s)
+	}
+	if v.Revision != "" {
+		s += "-" + v.Revision
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is older, equal or newer than other using the dpkg algorithm,
+// where "~" sorts before anything (even the end of the version). E.g: "1.0~rc1" < "1.0" < "1.0+b1"
+func (v Version) Compare(other Version) int {
+	if v.Epoch != other.Epoch {
+		if v.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(v.Upstream, other.Upstream); c != 0 {
+		return c
+	}
+	return compareVersionPart(v.Revision, other.Revision)
+}
+
+// CompareVersions parses and compares two version strings, see Version.Compare
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// versionOrder returns the sort weight of the first character of s, zero for digits and the end of s
+func versionOrder(s string) int {
+	if len(s) == 0 {
+		return 0
+	}
+	c := s[0]
+	switch {
+	case c >= '0' && c <= '9':
+		return 0
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+func isVersionDigit(s string) bool {
+	return len(s) > 0 && s[0] >= '0' && s[0] <= '9'
+}
+
+// compareVersionPart compares an upstream version or revision as dpkg verrevcmp does
+func compareVersionPart(a, b string) int {
+	for len(a) > 0 || len(b) > 0 {
+		// Compare the non-digit prefixes character by character
+		for (len(a) > 0 && !isVersionDigit(a)) || (len(b) > 0 && !isVersionDigit(b)) {
+			ac, bc := versionOrder(a), versionOrder(b)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		// Compare the digit sequences numerically
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		firstDiff := 0
+		for isVersionDigit(a) && isVersionDigit(b) {
+			if firstDiff == 0 {
+				firstDiff = int(a[0]) - int(b[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+		if isVersionDigit(a) {
+			return 1
+		}
+		if isVersionDigit(b) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
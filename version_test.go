@@ -0,0 +1,101 @@
+// Copyright 2017 Debpkg authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package debpkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Version
+	}{
+		{"1.0", Version{Upstream: "1.0"}},
+		{"1.0-1", Version{Upstream: "1.0", Revision: "1"}},
+		{"2:1.0-1ubuntu1", Version{Epoch: 2, Upstream: "1.0", Revision: "1ubuntu1"}},
+		{"1:1.0-rc1-2", Version{Epoch: 1, Upstream: "1.0-rc1", Revision: "2"}},
+		{"1:1:2.0", Version{Epoch: 1, Upstream: "1:2.0"}},
+		{"0.1.0+dev", Version{Upstream: "0.1.0+dev"}},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.in)
+		require.Nil(t, err, test.in)
+		assert.Equal(t, test.out, v)
+		assert.Equal(t, test.in, v.String())
+	}
+
+	for _, in := range []string{"", "a1.0", ":1.0", "-1:1.0", "1.0-", "1.0_1", "1 .0", "99999999999:1.0"} {
+		_, err := ParseVersion(in)
+		assert.NotNil(t, err, in)
+	}
+}
+
+// TestVersionCompare uses cases of the dpkg test suite
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.00", 0},
+		{"1.0-0", "1.0", 0},
+		{"0:1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.2", "1.10", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~~a", "1.0~~", 1},
+		{"1.0~", "1.0", -1},
+		{"1.0", "1.0+b1", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1:0.1", "9.9", 1},
+		{"2.0", "1:1.0", -1},
+		{"1.0-1~bpo1", "1.0-1", -1},
+		{"009", "9", 0},
+		{"1a", "1.0", -1},
+	}
+	for _, test := range tests {
+		cmp, err := CompareVersions(test.a, test.b)
+		require.Nil(t, err)
+		assert.Equal(t, test.cmp, cmp, "%s <=> %s", test.a, test.b)
+
+		cmp, err = CompareVersions(test.b, test.a)
+		require.Nil(t, err)
+		assert.Equal(t, -test.cmp, cmp, "%s <=> %s", test.b, test.a)
+	}
+
+	_, err := CompareVersions("1.0", "x")
+	assert.NotNil(t, err)
+}
+
+func TestSetVersionEpochRevision(t *testing.T) {
+	deb := New()
+	defer deb.Close()
+
+	deb.SetName("foo")
+	deb.SetArchitecture("amd64")
+	deb.SetVersionMajor(1)
+	deb.SetVersionMinor(2)
+	deb.SetVersionPatch(3)
+	deb.SetVersionEpoch(1)
+	deb.SetVersionRevision("2")
+	assert.Equal(t, "1:1.2.3-2", deb.control.version())
+	assert.Equal(t, "foo-1.2.3-2_amd64.deb", deb.GetFilename())
+
+	deb.SetVersion("2:4.5-1")
+	assert.Equal(t, "1:4.5-2", deb.control.version())
+
+	deb.SetVersionEpoch(0)
+	deb.SetVersionRevision("")
+	assert.Equal(t, "2:4.5-1", deb.control.version())
+	assert.Equal(t, "foo-4.5-1_amd64.deb", deb.GetFilename())
+}